@@ -0,0 +1,159 @@
+// Command migrate applies the schema migrations of internal/migrations to a
+// database, and rolls them back.
+//
+// Usage:
+//
+//	migrate [-config FILE] [-db mysql|postgres|sqlite] [-dsn DSN] up|down|status
+//
+// up applies every pending migration, down rolls back the latest applied
+// migration, and status lists the migrations along with when they were
+// applied.
+//
+// The database is the one of the web application, read from its settings
+// the same way: the configuration file, the environment variables, then the
+// -db and -dsn flags, as described in internal/config.
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"snippetbox.cnoua.org/internal/config"
+	"snippetbox.cnoua.org/internal/migrations"
+	"snippetbox.cnoua.org/internal/models"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+func main() {
+	// read the settings of the web application, the command follows the
+	// flags
+	cfg, args, err := config.LoadArgs(os.Args[0], os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		usage()
+		return
+	}
+	// the flag package already reported invalid arguments
+	if errors.Is(err, config.ErrUsage) {
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if cfg.PrintConfig {
+		cfg.Write(os.Stdout)
+		return
+	}
+
+	if len(args) != 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
+	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime)
+
+	dialect, ok := models.Dialects[cfg.DB.Backend]
+	if !ok {
+		errorLog.Fatalf("the %s backend has no schema to migrate", cfg.DB.Backend)
+	}
+	dsn := cfg.DB.DSN
+	if dsn == "" {
+		dsn = dialect.DefaultDSN
+	}
+
+	conn, err := sql.Open(dialect.Driver, dsn)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	defer conn.Close()
+
+	migrator, err := migrations.New(conn, cfg.DB.Backend)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	switch args[0] {
+	case "up":
+		err = up(migrator, infoLog)
+	case "down":
+		err = down(migrator, infoLog)
+	case "status":
+		err = status(migrator)
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		// log.Fatal() would skip closing the connection pool
+		errorLog.Print(err)
+		conn.Close()
+		os.Exit(1)
+	}
+}
+
+// usage prints the commands, the flags being printed by the flag package,
+// along with the ones of the other settings
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [flags] up|down|status\n", os.Args[0])
+}
+
+// up applies the pending migrations
+func up(migrator *migrations.Migrator, infoLog *log.Logger) error {
+	applied, err := migrator.Up()
+	for _, m := range applied {
+		infoLog.Printf("Applied %04d_%s", m.Version, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(applied) == 0 {
+		infoLog.Print("The schema is up to date")
+	}
+	return nil
+}
+
+// down rolls back the latest applied migration
+func down(migrator *migrations.Migrator, infoLog *log.Logger) error {
+	m, err := migrator.Down()
+	if errors.Is(err, migrations.ErrNoMigration) {
+		infoLog.Print("No migration is applied")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	infoLog.Printf("Rolled back %04d_%s", m.Version, m.Name)
+	return nil
+}
+
+// status prints the migrations along with when they were applied
+func status(migrator *migrations.Migrator) error {
+	status, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, m := range status {
+		applied := "pending"
+		if !m.Applied.IsZero() {
+			applied = m.Applied.Format("2006-01-02 15:04:05 UTC")
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", m.Version, m.Name, applied)
+	}
+
+	return w.Flush()
+}
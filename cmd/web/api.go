@@ -0,0 +1,433 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"snippetbox.cnoua.org/internal/models"
+)
+
+// maximum size of a JSON request body
+const maxJSONBodyBytes = 1 << 20
+
+// envelope wraps every JSON response in an object, e.g. {"snippet": {...}}
+type envelope map[string]any
+
+// apiErrorBody is the JSON representation of an error. Fields holds the
+// validation errors, keyed by the name of the JSON field they're about. ID
+// is the ID of the request, for the clients to quote when they report a
+// problem.
+type apiErrorBody struct {
+	Status  int               `json:"status"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+	ID      string            `json:"id"`
+}
+
+// snippetResponse is the JSON representation of a snippet
+type snippetResponse struct {
+	ID                 int       `json:"id"`
+	Title              string    `json:"title"`
+	Content            string    `json:"content"`
+	ContentType        string    `json:"content_type"`
+	Language           string    `json:"language"`
+	LanguageConfidence float64   `json:"language_confidence"`
+	Tags               []string  `json:"tags"`
+	AuthorID           int       `json:"author_id,omitempty"`
+	Author             string    `json:"author,omitempty"`
+	Created            time.Time `json:"created"`
+	Expires            time.Time `json:"expires"`
+}
+
+func newSnippetResponse(s *models.Snippet) snippetResponse {
+	tags := s.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return snippetResponse{
+		ID:                 s.ID,
+		Title:              s.Title,
+		Content:            s.Content,
+		ContentType:        s.ContentType,
+		Language:           s.Language,
+		LanguageConfidence: s.LanguageConfidence,
+		Tags:               tags,
+		AuthorID:           s.UserID,
+		Author:             s.UserName,
+		Created:            s.Created,
+		Expires:            s.Expires,
+	}
+}
+
+// snippetRequest is the JSON body of the requests creating or replacing a
+// snippet. Fields left out get the same defaults as the create form, except
+// for the expiry kept by the updates, they're tagged omitempty to be
+// documented as optional.
+type snippetRequest struct {
+	Title       string   `json:"title"`
+	Content     string   `json:"content"`
+	ContentType string   `json:"content_type,omitempty"`
+	Language    string   `json:"language,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Expires     int      `json:"expires,omitempty"`
+}
+
+// snippetUpdateRequest documents the body of the requests replacing a
+// snippet, which keep its expiry if expires is left out
+type snippetUpdateRequest snippetRequest
+
+// newSnippetRequest returns a request with the defaults of the fields,
+// expires being 365 days for the creations and models.KeepExpiry for the
+// updates
+func newSnippetRequest(expires int) snippetRequest {
+	return snippetRequest{
+		ContentType: models.ContentTypeText,
+		Language:    autoDetectLanguage,
+		Expires:     expires,
+	}
+}
+
+// form converts the request to a snippetCreateForm, so that API clients go
+// through the same validation checks as the HTML forms. The tags, sent as a
+// list, are left to validateTags rather than joined and parsed again.
+func (req snippetRequest) form() snippetCreateForm {
+	return snippetCreateForm{
+		Title:       req.Title,
+		Content:     req.Content,
+		Expires:     req.Expires,
+		Language:    req.Language,
+		ContentType: req.ContentType,
+	}
+}
+
+// tags returns the tags of the request without the duplicates
+func (req snippetRequest) tags() []string {
+	tags := []string{}
+	for _, tag := range req.Tags {
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// apiSnippetList sends a page of live snippets, newest first. It takes the
+// same query string parameters as the /snippets listing.
+func (app *application) apiSnippetList(w http.ResponseWriter, r *http.Request) {
+	f, size, err := readPageFilter(r)
+	if err != nil {
+		app.apiError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	snippets, err := app.snippets.Page(r.Context(), f)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	snippets, p := newPagination("/api/v1/snippets", f, size, snippets)
+	p.Query = tagsQuery(f.Tags)
+
+	data := make([]snippetResponse, len(snippets))
+	for i, s := range snippets {
+		data[i] = newSnippetResponse(s)
+	}
+
+	links := map[string]string{}
+	if p.Prev > 0 {
+		links["prev"] = p.PrevURL()
+	}
+	if p.Next > 0 {
+		links["next"] = p.NextURL()
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"snippets": data, "links": links}, nil)
+}
+
+func (app *application) apiSnippetView(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.apiRouteSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"snippet": newSnippetResponse(snippet)}, nil)
+}
+
+func (app *application) apiSnippetCreate(w http.ResponseWriter, r *http.Request) {
+	req := newSnippetRequest(365)
+	err := readJSON(w, r, &req)
+	if err != nil {
+		app.apiError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tags := req.tags()
+	form := req.form()
+	form.validate()
+	form.validateTags(tags)
+	if !form.Valid() {
+		app.apiValidationError(w, r, form.FieldErrors)
+		return
+	}
+
+	snippet := &models.Snippet{
+		Title:       form.Title,
+		Content:     form.Content,
+		ContentType: form.ContentType,
+		UserID:      app.authenticatedUserID(r),
+		Tags:        tags,
+	}
+	snippet.Language, snippet.LanguageConfidence = form.language()
+
+	id, err := app.snippets.Insert(r.Context(), snippet, form.Expires)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	// read the snippet back to send the timestamps set by the database
+	snippet, err = app.snippets.Get(r.Context(), id)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	headers := http.Header{}
+	headers.Set("Location", fmt.Sprintf("/api/v1/snippets/%d", id))
+
+	app.writeJSON(w, http.StatusCreated, envelope{"snippet": newSnippetResponse(snippet)}, headers)
+}
+
+// apiSnippetUpdate replaces a snippet with the one in the request body
+func (app *application) apiSnippetUpdate(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.apiOwnedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	req := newSnippetRequest(models.KeepExpiry)
+	err := readJSON(w, r, &req)
+	if err != nil {
+		app.apiError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tags := req.tags()
+	form := req.form()
+	form.validateEdit()
+	form.validateTags(tags)
+	if !form.Valid() {
+		app.apiValidationError(w, r, form.FieldErrors)
+		return
+	}
+
+	snippet.Title = form.Title
+	snippet.Content = form.Content
+	snippet.ContentType = form.ContentType
+	snippet.Language, snippet.LanguageConfidence = form.language()
+	snippet.Tags = tags
+
+	err = app.snippets.Update(r.Context(), snippet, form.Expires)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	// the snippet may have expired already, if its expiry was kept
+	snippet, err = app.snippets.GetIncludingExpired(r.Context(), snippet.ID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"snippet": newSnippetResponse(snippet)}, nil)
+}
+
+func (app *application) apiSnippetDelete(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.apiOwnedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.snippets.Delete(r.Context(), snippet.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiNotFound(w, r)
+		} else {
+			app.apiServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiUserSnippets sends all the snippets of the authenticated user,
+// including the expired ones, newest first
+func (app *application) apiUserSnippets(w http.ResponseWriter, r *http.Request) {
+	snippets, err := app.snippets.ByUser(r.Context(), app.authenticatedUserID(r))
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	data := make([]snippetResponse, len(snippets))
+	for i, s := range snippets {
+		data[i] = newSnippetResponse(s)
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"snippets": data}, nil)
+}
+
+// apiRouteSnippet works like routeSnippet, but sends JSON error responses
+func (app *application) apiRouteSnippet(w http.ResponseWriter, r *http.Request) (snippet *models.Snippet, ok bool) {
+	id := snippetID(r)
+	if id == 0 {
+		app.apiNotFound(w, r)
+		return nil, false
+	}
+
+	snippet, err := app.snippets.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiNotFound(w, r)
+		} else {
+			app.apiServerError(w, r, err)
+		}
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+// apiOwnedSnippet works like ownedSnippet, but sends JSON error responses
+func (app *application) apiOwnedSnippet(w http.ResponseWriter, r *http.Request) (snippet *models.Snippet, ok bool) {
+	id := snippetID(r)
+	if id == 0 {
+		app.apiNotFound(w, r)
+		return nil, false
+	}
+
+	snippet, err := app.snippets.GetIncludingExpired(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiNotFound(w, r)
+		} else {
+			app.apiServerError(w, r, err)
+		}
+		return nil, false
+	}
+
+	if snippet.UserID != app.authenticatedUserID(r) {
+		if snippet.Expired() {
+			app.apiNotFound(w, r)
+		} else {
+			app.apiError(w, r, http.StatusForbidden, "you are not the author of this snippet")
+		}
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+// writeJSON sends data encoded as JSON with the given status code and
+// additional headers
+func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) {
+	js, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		app.logger.Error("encoding JSON response", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	js = append(js, '\n')
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+}
+
+// readJSON decodes a JSON request body into dst. The body must hold a
+// single JSON value of at most maxJSONBodyBytes, with no unknown fields. The
+// returned errors are meant to be sent to the client.
+func readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxJSONBodyBytes)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &syntaxError):
+			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("body contains badly-formed JSON")
+		case errors.As(err, &unmarshalTypeError):
+			if unmarshalTypeError.Field != "" {
+				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+			}
+			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			return fmt.Errorf("body contains unknown field %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+		case errors.As(err, &maxBytesError):
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		default:
+			return err
+		}
+	}
+
+	// a second call to Decode must hit the end of the body
+	if err = dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return errors.New("body must only contain a single JSON value")
+	}
+
+	return nil
+}
+
+// apiError sends an error response in the JSON error envelope, carrying the
+// ID of the request like the error pages do
+func (app *application) apiError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	app.writeJSON(w, status, envelope{"error": apiErrorBody{Status: status, Message: message, ID: requestID(r)}}, nil)
+}
+
+// apiNotFound sends a 404 Not Found JSON error response
+func (app *application) apiNotFound(w http.ResponseWriter, r *http.Request) {
+	app.apiError(w, r, http.StatusNotFound, "the requested resource could not be found")
+}
+
+// apiUnauthorized sends a 401 Unauthorized JSON error response, telling the
+// client how to authenticate
+func (app *application) apiUnauthorized(w http.ResponseWriter, r *http.Request, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="snippetbox"`)
+	app.apiError(w, r, http.StatusUnauthorized, message)
+}
+
+// apiServerError is serverError for the API handlers, which answers them
+// with JSON errors since their paths start with /api/
+func (app *application) apiServerError(w http.ResponseWriter, r *http.Request, err error) {
+	app.serverError(w, r, err)
+}
+
+// apiValidationError sends a 422 Unprocessable Entity response carrying
+// the field errors of a validator.Validator
+func (app *application) apiValidationError(w http.ResponseWriter, r *http.Request, fieldErrors map[string]string) {
+	status := http.StatusUnprocessableEntity
+	body := apiErrorBody{Status: status, Message: "the request contains invalid fields", Fields: fieldErrors, ID: requestID(r)}
+	app.writeJSON(w, status, envelope{"error": body}, nil)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{
+			name: "Valid",
+			body: `{"title": "Hello", "tags": ["a", "b"], "expires": 7}`,
+		},
+		{
+			name:    "Empty",
+			body:    "",
+			wantErr: "body must not be empty",
+		},
+		{
+			name:    "Badly-formed",
+			body:    `{"title": "Hello",}`,
+			wantErr: "body contains badly-formed JSON (at character 19)",
+		},
+		{
+			name:    "Wrong type",
+			body:    `{"expires": "7"}`,
+			wantErr: `body contains incorrect JSON type for field "expires"`,
+		},
+		{
+			name:    "Unknown field",
+			body:    `{"author": "me"}`,
+			wantErr: `body contains unknown field "author"`,
+		},
+		{
+			name:    "Several values",
+			body:    `{} {}`,
+			wantErr: "body must only contain a single JSON value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/api/v1/snippets", strings.NewReader(tt.body))
+
+			req := newSnippetRequest(365)
+			err := readJSON(w, r, &req)
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("got error %q; want none", err)
+				}
+				// fields left out keep their default value
+				if req.Title != "Hello" || req.Expires != 7 || req.Language != autoDetectLanguage {
+					t.Errorf("got %+v", req)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("got error %v; want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSnippetRequestValidation(t *testing.T) {
+	req := newSnippetRequest(365)
+	req.Content = "SELECT 1;"
+	req.Tags = []string{"sql", "Bad/Tag"}
+	req.Expires = 30
+
+	form := req.form()
+	form.validate()
+	form.validateTags(req.tags())
+
+	// the field errors are keyed by the JSON field names
+	for _, field := range []string{"title", "tags", "expires"} {
+		if _, ok := form.FieldErrors[field]; !ok {
+			t.Errorf("want an error for %q, got %v", field, form.FieldErrors)
+		}
+	}
+	if len(form.FieldErrors) != 3 {
+		t.Errorf("got %d field errors; want 3", len(form.FieldErrors))
+	}
+}
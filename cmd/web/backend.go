@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"snippetbox.cnoua.org/internal/config"
+	"snippetbox.cnoua.org/internal/migrations"
+	"snippetbox.cnoua.org/internal/models"
+	"snippetbox.cnoua.org/internal/models/memory"
+	"snippetbox.cnoua.org/internal/search"
+
+	"github.com/alexedwards/scs/mysqlstore"
+	"github.com/alexedwards/scs/postgresstore"
+	"github.com/alexedwards/scs/sqlite3store"
+	"github.com/alexedwards/scs/v2"
+	"github.com/alexedwards/scs/v2/memstore"
+	_ "github.com/go-sql-driver/mysql" // alias package name to the blank identifier
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// backend holds the stores of a storage backend, along with the matching
+// session store. db is the connection pool of the SQL backends, nil for the
+// memory one. index is the snippet model of the SQL backends, whose search
+// index was built from the snippets changed before indexed, nil for the
+// memory one.
+type backend struct {
+	snippets  models.SnippetStore
+	revisions models.RevisionStore
+	users     models.UserStore
+	tokens    models.TokenStore
+	sessions  scs.Store
+	db        *sql.DB
+	index     *models.SnippetModel
+	indexed   time.Time
+}
+
+// close stops the goroutine of the session store deleting expired sessions,
+// then closes the connection pool. Sessions are written as each response is
+// sent, so there's nothing else to flush.
+func (b *backend) close() error {
+	if s, ok := b.sessions.(interface{ StopCleanup() }); ok {
+		s.StopCleanup()
+	}
+	if b.db == nil {
+		return nil
+	}
+	return b.db.Close()
+}
+
+// openBackend opens the storage backend of the configuration: "mysql",
+// "postgres", "sqlite" or "memory". The data source name of the SQL backends
+// is the backend's default one if empty.
+func openBackend(cfg *config.Config, logger *slog.Logger) (*backend, error) {
+	name, dsn := cfg.DB.Backend, cfg.DB.DSN
+
+	if name == "memory" {
+		db := memory.New()
+		users := db.Users()
+		users.BcryptCost = cfg.BcryptCost
+		return &backend{
+			snippets:  db.Snippets(),
+			revisions: db.Revisions(),
+			users:     users,
+			tokens:    db.Tokens(),
+			sessions:  memstore.New(),
+		}, nil
+	}
+
+	dialect, ok := models.Dialects[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown storage backend %q", name)
+	}
+	if dsn == "" {
+		dsn = dialect.DefaultDSN
+	}
+
+	// create a connection pool
+	db, err := openDB(dialect.Driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkSchema(db, name, cfg.DB.StrictSchema, logger)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	var sessions scs.Store
+	switch dialect {
+	case models.SQLite:
+		sessions = sqlite3store.New(db)
+	case models.Postgres:
+		sessions = postgresstore.New(db)
+	default:
+		sessions = mysqlstore.New(db)
+	}
+
+	// initialize the snippet model along with the search index of the live
+	// snippets
+	snippets := &models.SnippetModel{DB: db, Dialect: dialect, Index: search.NewIndex()}
+	indexed := models.Now()
+	err = snippets.BuildIndex(context.Background())
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	logger.Info("Indexed snippets for search", "count", snippets.Index.Len())
+
+	// reading every snippet takes a while, the query timeout is meant for
+	// the calls made while handling requests
+	timeout := cfg.DB.QueryTimeout
+	snippets.Timeout = timeout
+
+	return &backend{
+		snippets:  snippets,
+		revisions: &models.RevisionModel{DB: db, Dialect: dialect, Timeout: timeout},
+		users:     &models.UserModel{DB: db, Dialect: dialect, BcryptCost: cfg.BcryptCost, Timeout: timeout},
+		tokens:    &models.TokenModel{DB: db, Dialect: dialect, Timeout: timeout},
+		sessions:  sessions,
+		db:        db,
+		index:     snippets,
+		indexed:   indexed,
+	}, nil
+}
+
+// checkSchema looks for pending migrations of the database. The local SQLite
+// database is migrated on the fly, the other databases are migrated with
+// cmd/migrate: pending migrations make checkSchema fail if strict is true,
+// and are only logged otherwise.
+func checkSchema(db *sql.DB, dialect string, strict bool, logger *slog.Logger) error {
+	migrator, err := migrations.New(db, dialect)
+	if err != nil {
+		return err
+	}
+
+	if dialect == "sqlite" {
+		applied, err := migrator.Up()
+		if err != nil {
+			return err
+		}
+		for _, m := range applied {
+			logger.Info("Applied migration", "version", m.Version, "name", m.Name)
+		}
+		return nil
+	}
+
+	pending, err := migrator.Pending()
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	if strict {
+		return fmt.Errorf("the database schema is out of date, %d migrations are pending: run cmd/migrate up", len(pending))
+	}
+	logger.Warn("The database schema is out of date", "pending", len(pending))
+
+	return nil
+}
+
+// openDB() wraps sql.Open() and returns a sql.DB connection pool for a given
+// driver and DSN
+func openDB(driver, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Ping(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
@@ -1,5 +1,46 @@
 package main
 
+import "net/http"
+
 type contextKey string
 
 const isAuthenticatedContextKey = contextKey("isAuthenticated")
+const authenticatedUserIDContextKey = contextKey("authenticatedUserID")
+const apiTokenContextKey = contextKey("apiToken")
+const requestInfoContextKey = contextKey("requestInfo")
+
+// requestInfo holds what the access log and the metrics need to know about
+// a request. The assignRequestID middleware stores a pointer to it in the
+// request context, so the middleware further down the chain can fill it in:
+// the route is only known once the router matched it, and the user ID once
+// the request is authenticated.
+type requestInfo struct {
+	id     string
+	route  string
+	userID int
+}
+
+// requestID returns the ID of the request, or an empty string when the
+// request didn't go through the assignRequestID middleware
+func requestID(r *http.Request) string {
+	info, ok := r.Context().Value(requestInfoContextKey).(*requestInfo)
+	if !ok {
+		return ""
+	}
+	return info.id
+}
+
+// setRequestRoute records the pattern of the route the request matched
+func setRequestRoute(r *http.Request, pattern string) {
+	if info, ok := r.Context().Value(requestInfoContextKey).(*requestInfo); ok {
+		info.route = pattern
+	}
+}
+
+// setRequestUserID records the ID of the authenticated user for the access
+// log
+func setRequestUserID(r *http.Request, id int) {
+	if info, ok := r.Context().Value(requestInfoContextKey).(*requestInfo); ok {
+		info.userID = id
+	}
+}
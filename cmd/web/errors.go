@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/justinas/nosurf"
+	"snippetbox.cnoua.org/internal/models"
+)
+
+// errorMessages explains the error statuses to the users, on the error pages
+// and in the JSON errors
+var errorMessages = map[int]string{
+	http.StatusBadRequest:          "The request could not be understood. Please check it and try again.",
+	http.StatusForbidden:           "You don't have the permission to do this.",
+	http.StatusNotFound:            "The page you're looking for doesn't exist, or it has expired.",
+	http.StatusMethodNotAllowed:    "This page doesn't support the request method.",
+	http.StatusUnprocessableEntity: "The request contains invalid data.",
+	http.StatusTooManyRequests:     "You've sent too many requests. Please wait a moment and try again.",
+	http.StatusInternalServerError: "The server encountered a problem and could not process your request.",
+	http.StatusServiceUnavailable:  "The server is too busy to process your request. Please try again in a few seconds.",
+}
+
+// retryAfter is the Retry-After header of the 503 Service Unavailable
+// responses, in seconds
+const retryAfter = "5"
+
+// errorData holds what the error page shows. ID is the ID of the request,
+// which the users can quote when they report the problem, and which the
+// log lines of the request carry.
+type errorData struct {
+	Status  int
+	Title   string
+	Message string
+	ID      string
+}
+
+// errorResponse sends an error response with the given status code: a JSON
+// error to the API and to the clients asking for JSON, an HTML error page to
+// the others
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int) {
+	message, ok := errorMessages[status]
+	if !ok {
+		message = http.StatusText(status) + "."
+	}
+
+	if wantsJSON(r) {
+		app.apiError(w, r, status, message)
+		return
+	}
+
+	app.renderError(w, r, &errorData{
+		Status:  status,
+		Title:   http.StatusText(status),
+		Message: message,
+		ID:      requestID(r),
+	})
+}
+
+// wantsJSON returns true for the requests to the API, and for the requests
+// accepting JSON but not HTML
+func wantsJSON(r *http.Request) bool {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		return true
+	}
+
+	json, html := false, false
+	for _, value := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(value)
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "application/json":
+			json = true
+		case "text/html":
+			html = true
+		}
+	}
+	return json && !html
+}
+
+// renderError sends the error page. Unlike render, it doesn't need the
+// session, which the routes without the dynamic middleware don't load, and
+// it falls back to a plain text error should the page fail to render, so
+// that rendering errors can't loop.
+func (app *application) renderError(w http.ResponseWriter, r *http.Request, e *errorData) {
+	data := &templateData{
+		CurrentYear:         time.Now().Year(),
+		IsAuthenticated:     app.isAuthenticated(r),
+		AuthenticatedUserID: app.authenticatedUserID(r),
+		CSRFToken:           nosurf.Token(r),
+		Error:               e,
+	}
+
+	buf := new(bytes.Buffer)
+	err := errors.New("the template error.tmpl does not exist")
+	if ts, ok := app.templateCache["error.tmpl"]; ok {
+		err = ts.ExecuteTemplate(buf, "base", data)
+	}
+	if err != nil {
+		app.metrics.renderErrors.WithLabelValues("error.tmpl").Inc()
+		app.logger.Error(err.Error(), "request_id", e.ID)
+		http.Error(w, fmt.Sprintf("%s (error ID %s)", e.Message, e.ID), e.Status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(e.Status)
+	buf.WriteTo(w)
+}
+
+// serverError logs an error message & stack trace, along with the ID of the
+// request so the log lines can be tied together, then sends a generic 500
+// Internal Server Error response to the user. Queries which timed out get a
+// 503 Service Unavailable response instead.
+func (app *application) serverError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, models.ErrTimeout) {
+		// the database being overloaded doesn't call for a stack trace
+		app.logger.Warn(err.Error(),
+			"request_id", requestID(r),
+			"method", r.Method,
+			"uri", r.URL.RequestURI(),
+		)
+		w.Header().Set("Retry-After", retryAfter)
+		app.errorResponse(w, r, http.StatusServiceUnavailable)
+		return
+	}
+
+	app.logger.Error(err.Error(),
+		"request_id", requestID(r),
+		"method", r.Method,
+		"uri", r.URL.RequestURI(),
+		"trace", string(debug.Stack()),
+	)
+	app.errorResponse(w, r, http.StatusInternalServerError)
+}
+
+// clientError sends an error response with a specific status code to the user
+func (app *application) clientError(w http.ResponseWriter, r *http.Request, status int) {
+	app.errorResponse(w, r, status)
+}
+
+// convenience wrapper around clientError which sends a 404 to the user
+func (app *application) notFound(w http.ResponseWriter, r *http.Request) {
+	app.clientError(w, r, http.StatusNotFound)
+}
+
+// methodNotAllowed sends a 405 to the user, the router has already set the
+// Allow header
+func (app *application) methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	app.clientError(w, r, http.StatusMethodNotAllowed)
+}
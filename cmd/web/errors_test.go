@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestErrorResponses(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	tests := []struct {
+		name       string
+		method     string
+		urlPath    string
+		accept     string
+		wantStatus int
+		wantJSON   bool
+	}{
+		{"Page not found", http.MethodGet, "/missing", "text/html,application/xhtml+xml,*/*;q=0.8", http.StatusNotFound, false},
+		{"JSON client", http.MethodGet, "/missing", "application/json", http.StatusNotFound, true},
+		{"API route", http.MethodGet, "/api/v1/missing", "", http.StatusNotFound, true},
+		{"Method not allowed", http.MethodDelete, "/snippets", "", http.StatusMethodNotAllowed, false},
+		{"Session-less route", http.MethodGet, "/snippet/raw/1234", "", http.StatusNotFound, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.accept != "" {
+				header.Set("Accept", tt.accept)
+			}
+
+			code, rsHeader, body := ts.do(t, tt.method, tt.urlPath, "", nil, header)
+			if code != tt.wantStatus {
+				t.Errorf("got status %d; want %d", code, tt.wantStatus)
+			}
+			id := rsHeader.Get("X-Request-ID")
+
+			if tt.wantJSON {
+				var rs struct {
+					Error apiErrorBody `json:"error"`
+				}
+				if err := json.Unmarshal([]byte(body), &rs); err != nil {
+					t.Fatalf("decoding %q: %v", body, err)
+				}
+				if rs.Error.Status != tt.wantStatus || rs.Error.ID != id {
+					t.Errorf("got error %+v; want status %d and ID %q", rs.Error, tt.wantStatus, id)
+				}
+				return
+			}
+
+			if !strings.HasPrefix(rsHeader.Get("Content-Type"), "text/html") {
+				t.Errorf("got Content-Type %q; want an HTML page", rsHeader.Get("Content-Type"))
+			}
+			if !strings.Contains(body, "Error ID: <code>"+id+"</code>") {
+				t.Errorf("want the page to show the error ID %q", id)
+			}
+			if tt.wantStatus == http.StatusMethodNotAllowed && rsHeader.Get("Allow") == "" {
+				t.Error("want an Allow header")
+			}
+		})
+	}
+}
+
+func TestServerError(t *testing.T) {
+	var logs bytes.Buffer
+	app := newTestApplication(t)
+	app.logger = slog.New(slog.NewJSONHandler(&logs, nil))
+
+	var id string
+	handler := assignRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = requestID(r)
+		app.serverError(w, r, errors.New("boom"))
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d; want %d", rr.Code, http.StatusInternalServerError)
+	}
+	if !strings.Contains(rr.Body.String(), id) {
+		t.Errorf("want the page to show the error ID %q", id)
+	}
+	if !strings.Contains(logs.String(), `"request_id":"`+id+`"`) || !strings.Contains(logs.String(), `"msg":"boom"`) {
+		t.Errorf("got logs %q; want the error logged with its ID", logs.String())
+	}
+}
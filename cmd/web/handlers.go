@@ -3,11 +3,17 @@ package main
 import (
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
+	"snippetbox.cnoua.org/internal/diff"
+	"snippetbox.cnoua.org/internal/highlight"
+	"snippetbox.cnoua.org/internal/langdetect"
 	"snippetbox.cnoua.org/internal/models"
+	"snippetbox.cnoua.org/internal/search"
 	"snippetbox.cnoua.org/internal/validator"
 )
 
@@ -22,9 +28,71 @@ type snippetCreateForm struct {
 	Title               string `form:"title"`
 	Content             string `form:"content"`
 	Expires             int    `form:"expires"`
+	Tags                string `form:"tags"`
+	Language            string `form:"language"`
+	ContentType         string `form:"content_type"`
 	validator.Validator `form:"-"`
 }
 
+// limits checked by the snippet forms, also published in the OpenAPI document
+const (
+	maxTitleChars = 100
+	maxTags       = 10
+	maxTagChars   = 30
+)
+
+// the permitted values of the snippet form fields
+var (
+	expiresDays  = []int{1, 7, 365}
+	contentTypes = []string{models.ContentTypeText, models.ContentTypeMarkdown}
+)
+
+// validate runs the validation checks of the create form and of the API
+func (form *snippetCreateForm) validate() {
+	form.validateFields()
+	form.CheckField(validator.PermittedValue(form.Expires, expiresDays...), "expires", "This field must equal 1, 7 or 365")
+}
+
+// validateEdit runs the validation checks of the edit form, which also
+// offers to keep the expiry of the snippet as it is
+func (form *snippetCreateForm) validateEdit() {
+	form.validateFields()
+	form.CheckField(validator.PermittedValue(form.Expires, append([]int{models.KeepExpiry}, expiresDays...)...), "expires", "This field must equal 1, 7 or 365, or keep the current expiry")
+}
+
+// validateFields runs the validation checks of the fields other than the
+// expiry, shared by the create and edit forms
+func (form *snippetCreateForm) validateFields() {
+	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Title, maxTitleChars), "title", fmt.Sprintf("This field cannot be more than %d characters long", maxTitleChars))
+	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	form.CheckField(form.Language == autoDetectLanguage || highlight.Supported(form.Language), "language", "This field must be one of the listed languages")
+	form.CheckField(validator.PermittedValue(form.ContentType, contentTypes...), "content_type", "This field must be text or markdown")
+
+	form.validateTags(parseTags(form.Tags))
+}
+
+// validateTags runs the validation checks of the tags, parsed from the tags
+// field of the forms or sent as a list to the API
+func (form *snippetCreateForm) validateTags(tags []string) {
+	form.CheckField(validator.MaxItems(tags, maxTags), "tags", fmt.Sprintf("This field cannot have more than %d tags", maxTags))
+	form.CheckField(validator.AllMaxChars(tags, maxTagChars), "tags", fmt.Sprintf("Each tag cannot be more than %d characters long", maxTagChars))
+	form.CheckField(validator.AllMatches(tags, validator.TagRX), "tags", "Tags can only contain letters, digits and the characters _ . + -")
+}
+
+// the language form value asking for the language to be detected from the
+// snippet's content
+const autoDetectLanguage = "auto"
+
+// language returns the language picked in the form with a confidence of 1,
+// or the one detected from the content when left to auto-detection
+func (form *snippetCreateForm) language() (string, float64) {
+	if form.Language == autoDetectLanguage {
+		return langdetect.Detect(form.Title, form.Content)
+	}
+	return form.Language, 1
+}
+
 type userSignupForm struct {
 	Name                string `form:"name"`
 	Email               string `form:"email"`
@@ -38,21 +106,111 @@ type userLoginForm struct {
 	validator.Validator `form:"-"`
 }
 
+// tokenCreateForm holds the name and scopes of a new API token
+type tokenCreateForm struct {
+	Name                string   `form:"name"`
+	Scopes              []string `form:"scopes"`
+	validator.Validator `form:"-"`
+}
+
 // change the signature of home handler so it is defined as a method against *application
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
-	snippets, err := app.snippets.Latest()
+	// fetch one more snippet than displayed to know if there are older ones
+	// to link to, the listing can be filtered by a comma separated list of tags
+	f := models.PageFilter{
+		Limit: homePageSize + 1,
+		Tags:  parseTags(r.URL.Query().Get("tags")),
+	}
+
+	snippets, err := app.snippets.Page(r.Context(), f)
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
 	// get a templateData struct containing the default data (current year)
-	// and add the snippets slice to it
+	// and add the snippets slice to it, older snippets are browsed on the
+	// /snippets listing
 	data := app.newTemplateData(r)
-	data.Snippets = snippets
+	data.Tags = f.Tags
+	data.Snippets, data.Pagination = newPagination("/snippets", f, homePageSize, snippets)
+	data.Pagination.Query = tagsQuery(f.Tags)
 
 	// use render helper
-	app.render(w, http.StatusOK, "home.tmpl", data)
+	app.render(w, r, http.StatusOK, "home.tmpl", data)
+}
+
+// snippetList shows a page of all the live snippets, newest first
+func (app *application) snippetList(w http.ResponseWriter, r *http.Request) {
+	f, size, err := readPageFilter(r)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	snippets, err := app.snippets.Page(r.Context(), f)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Tags = f.Tags
+	data.Snippets, data.Pagination = newPagination("/snippets", f, size, snippets)
+	data.Pagination.Query = tagsQuery(f.Tags)
+
+	app.render(w, r, http.StatusOK, "list.tmpl", data)
+}
+
+// tagView shows a page of the live snippets having the tag given in the
+// "name" route parameter
+func (app *application) tagView(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	tag := params.ByName("name")
+	if !validator.Matches(tag, validator.TagRX) {
+		app.notFound(w, r)
+		return
+	}
+
+	f, size, err := readPageFilter(r)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+	f.Tags = []string{tag}
+
+	snippets, err := app.snippets.Page(r.Context(), f)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Tags = f.Tags
+	data.Snippets, data.Pagination = newPagination("/tag/"+tag, f, size, snippets)
+
+	app.render(w, r, http.StatusOK, "tag.tmpl", data)
+}
+
+// snippetSearch shows the live snippets matching the "q" query string
+// parameter, the best matches first
+func (app *application) snippetSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+
+	data := app.newTemplateData(r)
+	data.Search = &searchData{Q: q, Query: search.Parse(q)}
+
+	if !data.Search.Query.Empty() {
+		snippets, err := app.snippets.Search(r.Context(), data.Search.Query, maxSearchResults)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		data.Snippets = snippets
+	}
+
+	app.render(w, r, http.StatusOK, "search.tmpl", data)
 }
 
 func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
@@ -62,18 +220,18 @@ func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 	// get value of "id" parameter
 	id, err := strconv.Atoi(params.ByName("id"))
 	if err != nil || id < 1 {
-		app.notFound(w) // use notFoud() helper
+		app.notFound(w, r) // use notFoud() helper
 		return
 	}
 
 	// use the snippetModel Get method to retrieve the data for a specific ID, if no
 	// matching record found, return a 404 Not Found response
-	snippet, err := app.snippets.Get(id)
+	snippet, err := app.snippets.Get(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
-			app.notFound(w)
+			app.notFound(w, r)
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 		}
 		return
 	}
@@ -82,7 +240,150 @@ func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 	data.Snippet = snippet
 
-	app.render(w, http.StatusOK, "view.tmpl", data)
+	app.render(w, r, http.StatusOK, "view.tmpl", data)
+}
+
+// snippetRaw sends only the content of a snippet as plain text, so it can be
+// fetched with curl and friends
+func (app *application) snippetRaw(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.routeSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(snippet.Content))
+}
+
+// snippetDownload sends the content of a snippet as a file attachment, named
+// after its title and language
+func (app *application) snippetDownload(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.routeSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": snippetFilename(snippet)})
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", disposition)
+	w.Write([]byte(snippet.Content))
+}
+
+// snippetHistory lists every saved revision of a live snippet, for everyone
+// who can see the snippet to review what changed
+func (app *application) snippetHistory(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.routeSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := app.revisions.ForSnippet(r.Context(), snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Revisions = revisions
+
+	app.render(w, r, http.StatusOK, "history.tmpl", data)
+}
+
+// snippetDiff shows a unified diff between two revisions of a snippet, given
+// by their version numbers in the "from" and "to" query string parameters. By
+// default the latest revision is compared with the one before it.
+func (app *application) snippetDiff(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.routeSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := app.revisions.ForSnippet(r.Context(), snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if len(revisions) == 0 {
+		app.notFound(w, r)
+		return
+	}
+
+	// revisions are sorted newest first
+	to := revisions[0].Version
+	if v := r.URL.Query().Get("to"); v != "" {
+		to, err = strconv.Atoi(v)
+		if err != nil {
+			app.clientError(w, r, http.StatusBadRequest)
+			return
+		}
+	}
+	// the versions before the oldest kept revision may have been pruned
+	from := to
+	for _, revision := range revisions {
+		if revision.Version < to {
+			from = revision.Version
+			break
+		}
+	}
+	if v := r.URL.Query().Get("from"); v != "" {
+		from, err = strconv.Atoi(v)
+		if err != nil {
+			app.clientError(w, r, http.StatusBadRequest)
+			return
+		}
+	}
+
+	fromRevision, err := app.revisions.Get(r.Context(), snippet.ID, from)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+	toRevision, err := app.revisions.Get(r.Context(), snippet.ID, to)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Revisions = revisions
+	data.Diff = &revisionDiff{
+		From:  fromRevision,
+		To:    toRevision,
+		Hunks: diff.Hunks(diff.Lines(fromRevision.Content, toRevision.Content), 3),
+	}
+
+	app.render(w, r, http.StatusOK, "diff.tmpl", data)
+}
+
+// snippetHistoryPrunePost deletes every revision of a snippet but the latest,
+// for its author to get rid of content which wasn't meant to be published,
+// like a pasted secret since edited out
+func (app *application) snippetHistoryPrunePost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.revisions.Prune(r.Context(), snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Past revisions successfully deleted!")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d/history", snippet.ID), http.StatusSeeOther)
 }
 
 // for now return a placeholder response
@@ -90,12 +391,14 @@ func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 
 	// initialize a new createSnippetForm and pass it to the template
-	// set a default expiry time
+	// set a default expiry time, and detect the language of plain text by default
 	data.Form = snippetCreateForm{
-		Expires: 365,
+		Expires:     365,
+		Language:    autoDetectLanguage,
+		ContentType: models.ContentTypeText,
 	}
 
-	app.render(w, http.StatusOK, "create.tmpl", data)
+	app.render(w, r, http.StatusOK, "create.tmpl", data)
 }
 
 func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request) {
@@ -104,26 +407,32 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 
 	err := app.decodePostForm(r, &form)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.clientError(w, r, http.StatusBadRequest)
 		return
 	}
 	// execute validation checks
-	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
-	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
-	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
-	form.CheckField(validator.PermittedInt(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+	form.validate()
 
 	// use Valid() to see if any check failed, if so, re-render template
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "create.tmpl", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "create.tmpl", data)
 		return
 	}
 
-	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires)
+	snippet := &models.Snippet{
+		Title:       form.Title,
+		Content:     form.Content,
+		ContentType: form.ContentType,
+		UserID:      app.authenticatedUserID(r),
+		Tags:        parseTags(form.Tags),
+	}
+	snippet.Language, snippet.LanguageConfidence = form.language()
+
+	id, err := app.snippets.Insert(r.Context(), snippet, form.Expires)
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
@@ -134,10 +443,294 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
 }
 
+// routeSnippet retrieves the live snippet identified by the "id" route
+// parameter. If there's no such snippet the appropriate error response is
+// sent and ok is false.
+func (app *application) routeSnippet(w http.ResponseWriter, r *http.Request) (snippet *models.Snippet, ok bool) {
+	id := snippetID(r)
+	if id == 0 {
+		app.notFound(w, r)
+		return nil, false
+	}
+
+	snippet, err := app.snippets.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+// ownedSnippet works like routeSnippet, but also checks that the snippet
+// belongs to the current user, sending a 403 Forbidden response otherwise.
+// Only the author may change a snippet or see its past revisions, which they
+// may still do once it expired, until it's purged.
+func (app *application) ownedSnippet(w http.ResponseWriter, r *http.Request) (snippet *models.Snippet, ok bool) {
+	id := snippetID(r)
+	if id == 0 {
+		app.notFound(w, r)
+		return nil, false
+	}
+
+	snippet, err := app.snippets.GetIncludingExpired(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return nil, false
+	}
+
+	if snippet.UserID != app.authenticatedUserID(r) {
+		// to everyone else an expired snippet doesn't exist anymore
+		if snippet.Expired() {
+			app.notFound(w, r)
+		} else {
+			app.clientError(w, r, http.StatusForbidden)
+		}
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+// snippetID returns the "id" route parameter, or 0 if it isn't a valid
+// snippet id
+func snippetID(r *http.Request) int {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		return 0
+	}
+	return id
+}
+
+func (app *application) snippetEdit(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	// prefill the form with the current snippet values, keeping its expiry
+	// unless another one is picked. A detected language is left to detection
+	// again, in case the content changes.
+	form := snippetCreateForm{
+		Title:       snippet.Title,
+		Content:     snippet.Content,
+		Expires:     models.KeepExpiry,
+		Tags:        strings.Join(snippet.Tags, ", "),
+		Language:    snippet.Language,
+		ContentType: snippet.ContentType,
+	}
+	if snippet.LanguageConfidence < 1 {
+		form.Language = autoDetectLanguage
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Form = form
+
+	app.render(w, r, http.StatusOK, "edit.tmpl", data)
+}
+
+func (app *application) snippetEditPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	var form snippetCreateForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	form.validateEdit()
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "edit.tmpl", data)
+		return
+	}
+
+	snippet.Title = form.Title
+	snippet.Content = form.Content
+	snippet.ContentType = form.ContentType
+	snippet.Language, snippet.LanguageConfidence = form.language()
+	snippet.Tags = parseTags(form.Tags)
+
+	err = app.snippets.Update(r.Context(), snippet, form.Expires)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully updated!")
+
+	// an expired snippet whose expiry was kept can only be seen among the
+	// user's snippets
+	if form.Expires == models.KeepExpiry && snippet.Expired() {
+		http.Redirect(w, r, "/user/snippets", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+func (app *application) snippetDeletePost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.snippets.Delete(r.Context(), snippet.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully deleted!")
+
+	http.Redirect(w, r, "/user/snippets", http.StatusSeeOther)
+}
+
+// userSnippets shows the logged-in user's own snippets, split into the
+// active and the expired ones
+func (app *application) userSnippets(w http.ResponseWriter, r *http.Request) {
+	snippets, err := app.snippets.ByUser(r.Context(), app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = []*models.Snippet{}
+	data.ExpiredSnippets = []*models.Snippet{}
+	for _, s := range snippets {
+		if s.Expired() {
+			data.ExpiredSnippets = append(data.ExpiredSnippets, s)
+		} else {
+			data.Snippets = append(data.Snippets, s)
+		}
+	}
+
+	app.render(w, r, http.StatusOK, "snippets.tmpl", data)
+}
+
+// accountTokens lists the API tokens of the logged-in user, along with a
+// form to create a new one
+func (app *application) accountTokens(w http.ResponseWriter, r *http.Request) {
+	data, err := app.newTokensTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	data.Form = tokenCreateForm{Scopes: []string{models.ScopeRead}}
+
+	app.render(w, r, http.StatusOK, "tokens.tmpl", data)
+}
+
+// accountTokensPost creates an API token. The token is only shown in the
+// response to this request, as the database only keeps its hash.
+func (app *application) accountTokensPost(w http.ResponseWriter, r *http.Request) {
+	var form tokenCreateForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Name, 50), "name", "This field cannot be more than 50 characters long")
+	form.CheckField(len(form.Scopes) > 0, "scopes", "Pick at least one scope")
+	form.CheckField(validator.AllPermitted(form.Scopes, models.Scopes...), "scopes", "This field must only contain listed scopes")
+
+	if !form.Valid() {
+		data, err := app.newTokensTemplateData(r)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "tokens.tmpl", data)
+		return
+	}
+
+	token, _, err := app.tokens.Insert(r.Context(), app.authenticatedUserID(r), form.Name, form.Scopes)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// list the tokens after the insert, so that the new one is included
+	data, err := app.newTokensTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	data.NewToken = token
+	data.Form = tokenCreateForm{Scopes: []string{models.ScopeRead}}
+
+	app.render(w, r, http.StatusOK, "tokens.tmpl", data)
+}
+
+func (app *application) accountTokenRevokePost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	// tokens of other users aren't found, rather than forbidden
+	err = app.tokens.Revoke(r.Context(), app.authenticatedUserID(r), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Token successfully revoked!")
+
+	http.Redirect(w, r, "/account/tokens", http.StatusSeeOther)
+}
+
+// newTokensTemplateData returns the template data of the tokens page, with
+// the tokens of the logged-in user
+func (app *application) newTokensTemplateData(r *http.Request) (*templateData, error) {
+	tokens, err := app.tokens.ForUser(r.Context(), app.authenticatedUserID(r))
+	if err != nil {
+		return nil, err
+	}
+
+	data := app.newTemplateData(r)
+	data.Tokens = tokens
+	return data, nil
+}
+
 func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 	data.Form = userSignupForm{}
-	app.render(w, http.StatusOK, "signup.tmpl", data)
+	app.render(w, r, http.StatusOK, "signup.tmpl", data)
 }
 
 func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
@@ -146,10 +739,12 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 	// parse the data into it
 	err := app.decodePostForm(r, &form)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.clientError(w, r, http.StatusBadRequest)
 		return
 	}
 
+	form.Email = normalizeEmail(form.Email)
+
 	// validate form contents
 	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
 	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
@@ -161,22 +756,22 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "signup.tmpl", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "signup.tmpl", data)
 		return
 	}
 
 	// try to create a new user record in the db, if email already exists
 	// add an error message to the form and re-display it
-	err = app.users.Insert(form.Name, form.Email, form.Password)
+	err = app.users.Insert(r.Context(), form.Name, form.Email, form.Password)
 	if err != nil {
 		if errors.Is(err, models.ErrDuplicateEmail) {
 			form.AddFieldError("email", "Email address is already in use")
 
 			data := app.newTemplateData(r)
 			data.Form = form
-			app.render(w, http.StatusUnprocessableEntity, "signup.tmpl", data)
+			app.render(w, r, http.StatusUnprocessableEntity, "signup.tmpl", data)
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 		}
 		return
 	}
@@ -190,7 +785,7 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 	data.Form = userLoginForm{}
-	app.render(w, http.StatusOK, "login.tmpl", data)
+	app.render(w, r, http.StatusOK, "login.tmpl", data)
 }
 
 func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
@@ -199,10 +794,12 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 
 	err := app.decodePostForm(r, &form)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.clientError(w, r, http.StatusBadRequest)
 		return
 	}
 
+	form.Email = normalizeEmail(form.Email)
+
 	// validation checks
 	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
 	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
@@ -212,21 +809,21 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 		data := app.newTemplateData(r)
 		app.newTemplateData(r)
 		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "login.tmpl", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "login.tmpl", data)
 		return
 	}
 	// check if credentials are valid, if not, add a generic
 	// non-field error message & re-display login page
-	id, err := app.users.Authenticate(form.Email, form.Password)
+	id, err := app.users.Authenticate(r.Context(), form.Email, form.Password)
 	if err != nil {
 		if errors.Is(err, models.ErrInvalidCredentials) {
 			form.AddNonFieldError("Email or password is incorrect")
 
 			data := app.newTemplateData(r)
 			data.Form = form
-			app.render(w, http.StatusUnprocessableEntity, "login.tmpl", data)
+			app.render(w, r, http.StatusUnprocessableEntity, "login.tmpl", data)
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 		}
 		return
 	}
@@ -236,7 +833,7 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 	// state or privilege levels change for the user (e.g. login & logout ops)
 	err = app.sessionManager.RenewToken(r.Context())
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
@@ -251,7 +848,7 @@ func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
 	// change current session ID
 	err := app.sessionManager.RenewToken(r.Context())
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
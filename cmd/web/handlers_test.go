@@ -0,0 +1,921 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"snippetbox.cnoua.org/internal/models"
+)
+
+// insertSnippet adds a snippet of the given user to the application's store
+func insertSnippet(t *testing.T, app *application, userID int, title, content string) int {
+	t.Helper()
+
+	id, err := app.snippets.Insert(t.Context(), &models.Snippet{
+		Title:       title,
+		Content:     content,
+		ContentType: models.ContentTypeText,
+		UserID:      userID,
+	}, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestPing(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	code, _, body := ts.get(t, "/ping")
+
+	if code != http.StatusOK {
+		t.Errorf("got status %d; want %d", code, http.StatusOK)
+	}
+	if body != "OK" {
+		t.Errorf("got body %q; want %q", body, "OK")
+	}
+}
+
+func TestSnippetView(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	userID := signup(t, app, "Alice", "alice@example.com", "pa$$word")
+	id := insertSnippet(t, app, userID, "An old silent pond", "An old silent pond...")
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{"Valid ID", fmt.Sprintf("/snippet/view/%d", id), http.StatusOK, "An old silent pond..."},
+		{"Non-existent ID", "/snippet/view/999", http.StatusNotFound, ""},
+		{"Negative ID", "/snippet/view/-1", http.StatusNotFound, ""},
+		{"Decimal ID", "/snippet/view/1.23", http.StatusNotFound, ""},
+		{"String ID", "/snippet/view/foo", http.StatusNotFound, ""},
+		{"Empty ID", "/snippet/view/", http.StatusNotFound, ""},
+		{"Raw", fmt.Sprintf("/snippet/raw/%d", id), http.StatusOK, "An old silent pond..."},
+		{"Raw non-existent ID", "/snippet/raw/999", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Errorf("got status %d; want %d", code, tt.wantCode)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("got body %q; want it to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSnippetList(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	userID := signup(t, app, "Alice", "alice@example.com", "pa$$word")
+	var ids []int
+	for i := 1; i <= 5; i++ {
+		ids = append(ids, insertSnippet(t, app, userID, fmt.Sprintf("Snippet %d", i), "content"))
+	}
+
+	// the pages link to the snippets before and after them, newest first
+	tests := []struct {
+		name       string
+		urlPath    string
+		wantCode   int
+		wantTitles []string
+		wantPrev   string
+		wantNext   string
+	}{
+		{"First page", "/snippets?size=2", http.StatusOK, []string{"Snippet 5", "Snippet 4"}, "", fmt.Sprintf("/snippets?before=%d&amp;size=2", ids[3])},
+		{"Middle page", fmt.Sprintf("/snippets?size=2&before=%d", ids[3]), http.StatusOK, []string{"Snippet 3", "Snippet 2"}, fmt.Sprintf("/snippets?after=%d&amp;size=2", ids[2]), fmt.Sprintf("/snippets?before=%d&amp;size=2", ids[1])},
+		{"Last page", fmt.Sprintf("/snippets?size=2&before=%d", ids[1]), http.StatusOK, []string{"Snippet 1"}, fmt.Sprintf("/snippets?after=%d&amp;size=2", ids[0]), ""},
+		{"Back to the first page", fmt.Sprintf("/snippets?size=2&after=%d", ids[2]), http.StatusOK, []string{"Snippet 5", "Snippet 4"}, "", fmt.Sprintf("/snippets?before=%d&amp;size=2", ids[3])},
+		{"Back to a middle page", fmt.Sprintf("/snippets?size=2&after=%d", ids[0]), http.StatusOK, []string{"Snippet 3", "Snippet 2"}, fmt.Sprintf("/snippets?after=%d&amp;size=2", ids[2]), fmt.Sprintf("/snippets?before=%d&amp;size=2", ids[1])},
+		{"Default size", "/snippets", http.StatusOK, []string{"Snippet 5", "Snippet 4", "Snippet 3", "Snippet 2", "Snippet 1"}, "", ""},
+		{"Before and after", "/snippets?before=3&after=1", http.StatusBadRequest, nil, "", ""},
+		{"Invalid cursor", "/snippets?before=foo", http.StatusBadRequest, nil, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Errorf("got status %d; want %d", code, tt.wantCode)
+			}
+			for i := 1; i <= 5; i++ {
+				title := fmt.Sprintf("Snippet %d", i)
+				want := slices.Contains(tt.wantTitles, title)
+				if strings.Contains(body, ">"+title+"<") != want {
+					t.Errorf("got %s listed: %t; want %t", title, !want, want)
+				}
+			}
+			last := -1
+			for _, title := range tt.wantTitles {
+				i := strings.Index(body, ">"+title+"<")
+				if i < last {
+					t.Errorf("got %s listed out of order; want %q", title, tt.wantTitles)
+				}
+				last = i
+			}
+			for _, link := range []struct{ class, want string }{{"prev", tt.wantPrev}, {"next", tt.wantNext}} {
+				rx := regexp.MustCompile(`class="` + link.class + `" href="([^"]*)"`)
+				got := ""
+				if m := rx.FindStringSubmatch(body); m != nil {
+					got = m[1]
+				}
+				if got != link.want {
+					t.Errorf("got %s link %q; want %q", link.class, got, link.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSnippetSearch(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	userID := signup(t, app, "Alice", "alice@example.com", "pa$$word")
+	insertSnippet(t, app, userID, "Backup script", "pg_dump the production database")
+	insertSnippet(t, app, userID, "Deploy", "ssh to staging and restart the database")
+
+	tests := []struct {
+		name       string
+		urlPath    string
+		wantBody   []string
+		unwantBody []string
+	}{
+		{
+			name:       "Title match",
+			urlPath:    "/search?q=backup",
+			wantBody:   []string{"<mark>Backup</mark> script", "Results for &ldquo;backup&rdquo;"},
+			unwantBody: []string{"Deploy"},
+		},
+		{
+			name:     "Content match",
+			urlPath:  "/search?q=database",
+			wantBody: []string{"Backup script", "Deploy", "production <mark>database</mark>", "restart the <mark>database</mark>"},
+		},
+		{
+			name:       "Excluded word",
+			urlPath:    "/search?q=database+-staging",
+			wantBody:   []string{"Backup script"},
+			unwantBody: []string{"Deploy"},
+		},
+		{
+			name:       "Markup escaped",
+			urlPath:    "/search?q=%3Ckubernetes%3E",
+			wantBody:   []string{"No snippets match &ldquo;&lt;kubernetes&gt;&rdquo;"},
+			unwantBody: []string{"<kubernetes>"},
+		},
+		{
+			name:       "No match",
+			urlPath:    "/search?q=kubernetes",
+			wantBody:   []string{"No snippets match &ldquo;kubernetes&rdquo;"},
+			unwantBody: []string{"Backup script", "Deploy"},
+		},
+		{
+			name:       "Empty query",
+			urlPath:    "/search?q=",
+			wantBody:   []string{`<form class="search"`},
+			unwantBody: []string{"Results for", "No snippets match", "Backup script"},
+		},
+		{
+			name:       "No query",
+			urlPath:    "/search",
+			wantBody:   []string{`<form class="search"`},
+			unwantBody: []string{"Results for", "No snippets match", "Backup script"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			if code != http.StatusOK {
+				t.Errorf("got status %d; want %d", code, http.StatusOK)
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(body, want) {
+					t.Errorf("got body %q; want it to contain %q", body, want)
+				}
+			}
+			for _, unwant := range tt.unwantBody {
+				if strings.Contains(body, unwant) {
+					t.Errorf("got body %q; want it not to contain %q", body, unwant)
+				}
+			}
+		})
+	}
+}
+
+func TestSnippetTags(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	userID := signup(t, app, "Alice", "alice@example.com", "pa$$word")
+	var ids []int
+	for _, s := range []struct {
+		title string
+		tags  []string
+	}{
+		{"Go server", []string{"go"}},
+		{"Python script", []string{"python"}},
+		{"Go query", []string{"go", "sql"}},
+	} {
+		id, err := app.snippets.Insert(t.Context(), &models.Snippet{
+			Title:       s.title,
+			Content:     "content",
+			ContentType: models.ContentTypeText,
+			UserID:      userID,
+			Tags:        s.tags,
+		}, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	tests := []struct {
+		name       string
+		urlPath    string
+		wantCode   int
+		wantTitles []string
+		wantLink   string
+	}{
+		{"Tag page", "/tag/go", http.StatusOK, []string{"Go server", "Go query"}, ""},
+		{"Tag page of another tag", "/tag/sql", http.StatusOK, []string{"Go query"}, ""},
+		{"Unused tag", "/tag/rust", http.StatusOK, nil, ""},
+		{"Invalid tag", "/tag/Go", http.StatusNotFound, nil, ""},
+		{"Home", "/", http.StatusOK, []string{"Go server", "Python script", "Go query"}, ""},
+		{"Home filtered", "/?tags=go", http.StatusOK, []string{"Go server", "Go query"}, ""},
+		{"Home filtered by several tags", "/?tags=go,sql", http.StatusOK, []string{"Go query"}, ""},
+		{"Home filtered by tags in any case", "/?tags=SQL+Go", http.StatusOK, []string{"Go query"}, ""},
+		{"Home filtered by an unused tag", "/?tags=rust", http.StatusOK, nil, ""},
+		{"Home with an empty filter", "/?tags=", http.StatusOK, []string{"Go server", "Python script", "Go query"}, ""},
+		{"Listing filtered", "/snippets?tags=python", http.StatusOK, []string{"Python script"}, ""},
+		// the paging links keep the filter
+		{"Listing filtered, paged", "/snippets?tags=go&size=1", http.StatusOK, []string{"Go query"}, fmt.Sprintf(`href="/snippets?before=%d&amp;size=1&amp;tags=go"`, ids[2])},
+		{"Tag page, paged", "/tag/go?size=1", http.StatusOK, []string{"Go query"}, fmt.Sprintf(`href="/tag/go?before=%d&amp;size=1"`, ids[2])},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Errorf("got status %d; want %d", code, tt.wantCode)
+			}
+			for _, title := range []string{"Go server", "Python script", "Go query"} {
+				want := slices.Contains(tt.wantTitles, title)
+				if strings.Contains(body, ">"+title+"<") != want {
+					t.Errorf("got %s listed: %t; want %t", title, !want, want)
+				}
+			}
+			if !strings.Contains(body, tt.wantLink) {
+				t.Errorf("got body %q; want it to contain %q", body, tt.wantLink)
+			}
+		})
+	}
+}
+
+func TestSnippetDownload(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	userID := signup(t, app, "Alice", "alice@example.com", "pa$$word")
+	id := insertSnippet(t, app, userID, "Backup script", "#!/bin/sh\n")
+
+	code, header, _ := ts.get(t, fmt.Sprintf("/snippet/download/%d", id))
+
+	if code != http.StatusOK {
+		t.Errorf("got status %d; want %d", code, http.StatusOK)
+	}
+	want := "attachment; filename=backup-script.txt"
+	if got := header.Get("Content-Disposition"); got != want {
+		t.Errorf("got Content-Disposition %q; want %q", got, want)
+	}
+}
+
+func TestUserSignup(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	signup(t, app, "Alice", "alice@example.com", "pa$$word")
+
+	_, _, body := ts.get(t, "/user/signup")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		userName string
+		email    string
+		password string
+		csrf     string
+		wantCode int
+		wantBody string
+	}{
+		{"Valid submission", "Bob", "bob@example.com", "validPa$$word", csrfToken, http.StatusSeeOther, ""},
+		{"Invalid CSRF token", "Bob", "bob@example.com", "validPa$$word", "wrongToken", http.StatusBadRequest, ""},
+		{"Empty name", "", "bob@example.com", "validPa$$word", csrfToken, http.StatusUnprocessableEntity, "This field cannot be blank"},
+		{"Invalid email", "Bob", "bob@example.", "validPa$$word", csrfToken, http.StatusUnprocessableEntity, "This field must be a valid email address"},
+		{"Short password", "Bob", "bob@example.com", "pa$$", csrfToken, http.StatusUnprocessableEntity, "This field must be at least 8 characters long"},
+		{"Duplicate email", "Alice", "alice@example.com", "pa$$word", csrfToken, http.StatusUnprocessableEntity, "Email address is already in use"},
+		{"Duplicate email in another case", "Alice", " Alice@Example.COM", "pa$$word", csrfToken, http.StatusUnprocessableEntity, "Email address is already in use"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{
+				"name":       {tt.userName},
+				"email":      {tt.email},
+				"password":   {tt.password},
+				"csrf_token": {tt.csrf},
+			}
+
+			code, _, body := ts.postForm(t, "/user/signup", form)
+
+			if code != tt.wantCode {
+				t.Errorf("got status %d; want %d", code, tt.wantCode)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("got body %q; want it to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestUserLoginEmailCase(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	_, _, body := ts.get(t, "/user/signup")
+	code, _, _ := ts.postForm(t, "/user/signup", url.Values{
+		"name":       {"Alice"},
+		"email":      {"Alice@Example.com"},
+		"password":   {"pa$$word"},
+		"csrf_token": {extractCSRFToken(t, body)},
+	})
+	if code != http.StatusSeeOther {
+		t.Fatalf("got status %d signing up; want %d", code, http.StatusSeeOther)
+	}
+
+	// the email is stored lower-cased, so it matches whatever its case
+	if _, err := app.users.Authenticate(t.Context(), "alice@example.com", "pa$$word"); err != nil {
+		t.Errorf("authenticating with the stored email: %v", err)
+	}
+	ts.login(t, "ALICE@example.com ", "pa$$word")
+}
+
+func TestSnippetCreate(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	signup(t, app, "Alice", "alice@example.com", "pa$$word")
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		code, header, _ := ts.get(t, "/snippet/create")
+
+		if code != http.StatusSeeOther {
+			t.Errorf("got status %d; want %d", code, http.StatusSeeOther)
+		}
+		if got := header.Get("Location"); got != "/user/login" {
+			t.Errorf("got Location %q; want %q", got, "/user/login")
+		}
+	})
+
+	csrfToken := ts.login(t, "alice@example.com", "pa$$word")
+
+	t.Run("Authenticated", func(t *testing.T) {
+		code, _, body := ts.get(t, "/snippet/create")
+
+		if code != http.StatusOK {
+			t.Errorf("got status %d; want %d", code, http.StatusOK)
+		}
+		if !strings.Contains(body, `<form action="/snippet/create" method="POST">`) {
+			t.Error("want the create form in the body")
+		}
+	})
+
+	t.Run("Invalid submission", func(t *testing.T) {
+		form := url.Values{
+			"title":        {""},
+			"content":      {"SELECT 1;"},
+			"expires":      {"365"},
+			"language":     {"auto"},
+			"content_type": {"text"},
+			"csrf_token":   {csrfToken},
+		}
+
+		code, _, body := ts.postForm(t, "/snippet/create", form)
+
+		if code != http.StatusUnprocessableEntity {
+			t.Errorf("got status %d; want %d", code, http.StatusUnprocessableEntity)
+		}
+		if !strings.Contains(body, "This field cannot be blank") {
+			t.Error("want the title error in the body")
+		}
+	})
+
+	t.Run("Valid submission", func(t *testing.T) {
+		form := url.Values{
+			"title":        {"Count"},
+			"content":      {"SELECT COUNT(*) FROM snippets;"},
+			"expires":      {"7"},
+			"language":     {"sql"},
+			"content_type": {"text"},
+			"tags":         {"sql, Stats"},
+			"csrf_token":   {csrfToken},
+		}
+
+		code, header, _ := ts.postForm(t, "/snippet/create", form)
+
+		if code != http.StatusSeeOther {
+			t.Fatalf("got status %d; want %d", code, http.StatusSeeOther)
+		}
+
+		code, _, body := ts.get(t, header.Get("Location"))
+		if code != http.StatusOK {
+			t.Errorf("got status %d; want %d", code, http.StatusOK)
+		}
+		for _, want := range []string{"Snippet successfully created!", "By Alice", `href="/tag/stats"`} {
+			if !strings.Contains(body, want) {
+				t.Errorf("want %q in the body", want)
+			}
+		}
+	})
+}
+
+func TestUserSnippets(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	aliceID := signup(t, app, "Alice", "alice@example.com", "pa$$word")
+	bobID := signup(t, app, "Bob", "bob@example.com", "pa$$word")
+	insertSnippet(t, app, aliceID, "Alice's live snippet", "mine")
+	insertSnippet(t, app, bobID, "Bob's snippet", "his")
+	_, err := app.snippets.Insert(t.Context(), &models.Snippet{
+		Title:       "Alice's expired snippet",
+		Content:     "mine, from yesterday",
+		ContentType: models.ContentTypeText,
+		UserID:      aliceID,
+	}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		code, header, _ := ts.get(t, "/user/snippets")
+		if code != http.StatusSeeOther || header.Get("Location") != "/user/login" {
+			t.Errorf("got status %d to %q; want a redirect to the login page", code, header.Get("Location"))
+		}
+	})
+
+	t.Run("Authenticated", func(t *testing.T) {
+		ts.login(t, "alice@example.com", "pa$$word")
+
+		code, _, body := ts.get(t, "/user/snippets")
+		if code != http.StatusOK {
+			t.Fatalf("got status %d; want %d", code, http.StatusOK)
+		}
+		for _, want := range []string{"Active Snippets (1)", "Alice&#39;s live snippet", "Expired Snippets (1)", "Alice&#39;s expired snippet"} {
+			if !strings.Contains(body, want) {
+				t.Errorf("want %q in the body", want)
+			}
+		}
+		if strings.Contains(body, "Bob") {
+			t.Error("want no snippet of another user in the body")
+		}
+	})
+}
+
+func TestSnippetEditOwnership(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	aliceID := signup(t, app, "Alice", "alice@example.com", "pa$$word")
+	signup(t, app, "Bob", "bob@example.com", "pa$$word")
+	id := insertSnippet(t, app, aliceID, "Alice's snippet", "mine")
+
+	csrfToken := ts.login(t, "bob@example.com", "pa$$word")
+
+	code, _, _ := ts.get(t, fmt.Sprintf("/snippet/edit/%d", id))
+	if code != http.StatusForbidden {
+		t.Errorf("got status %d editing; want %d", code, http.StatusForbidden)
+	}
+
+	code, _, _ = ts.postForm(t, fmt.Sprintf("/snippet/delete/%d", id), url.Values{"csrf_token": {csrfToken}})
+	if code != http.StatusForbidden {
+		t.Errorf("got status %d deleting; want %d", code, http.StatusForbidden)
+	}
+
+	if _, err := app.snippets.Get(t.Context(), id); err != nil {
+		t.Errorf("want the snippet to still exist, got %v", err)
+	}
+}
+
+func TestSnippetEditExpiry(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	aliceID := signup(t, app, "Alice", "alice@example.com", "pa$$word")
+	signup(t, app, "Bob", "bob@example.com", "pa$$word")
+	liveID := insertSnippet(t, app, aliceID, "Alice's snippet", "mine")
+	expiredID, err := app.snippets.Insert(t.Context(), &models.Snippet{
+		Title:       "Alice's old snippet",
+		Content:     "mine, from yesterday",
+		ContentType: models.ContentTypeText,
+		UserID:      aliceID,
+	}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	live, err := app.snippets.Get(t.Context(), liveID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := app.snippets.GetIncludingExpired(t.Context(), expiredID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edit := func(t *testing.T, csrfToken string, id int, expires string) (int, string) {
+		t.Helper()
+		code, header, _ := ts.postForm(t, fmt.Sprintf("/snippet/edit/%d", id), url.Values{
+			"csrf_token":   {csrfToken},
+			"title":        {"Edited"},
+			"content":      {"edited"},
+			"content_type": {models.ContentTypeText},
+			"language":     {autoDetectLanguage},
+			"expires":      {expires},
+		})
+		return code, header.Get("Location")
+	}
+
+	t.Run("Another user", func(t *testing.T) {
+		csrfToken := ts.login(t, "bob@example.com", "pa$$word")
+
+		// an expired snippet doesn't exist anymore to anyone but its author
+		code, _, _ := ts.get(t, fmt.Sprintf("/snippet/edit/%d", expiredID))
+		if code != http.StatusNotFound {
+			t.Errorf("got status %d editing; want %d", code, http.StatusNotFound)
+		}
+		code, _, _ = ts.postForm(t, fmt.Sprintf("/snippet/delete/%d", expiredID), url.Values{"csrf_token": {csrfToken}})
+		if code != http.StatusNotFound {
+			t.Errorf("got status %d deleting; want %d", code, http.StatusNotFound)
+		}
+	})
+
+	t.Run("Author", func(t *testing.T) {
+		csrfToken := ts.login(t, "alice@example.com", "pa$$word")
+
+		// the current expiry is kept by default
+		code, _, body := ts.get(t, fmt.Sprintf("/snippet/edit/%d", liveID))
+		if code != http.StatusOK || !strings.Contains(body, "value='0' checked") {
+			t.Errorf("got status %d; want %d with the current expiry kept", code, http.StatusOK)
+		}
+
+		code, location := edit(t, csrfToken, liveID, "0")
+		if code != http.StatusSeeOther || location != fmt.Sprintf("/snippet/view/%d", liveID) {
+			t.Errorf("got status %d to %q; want a redirect to the snippet", code, location)
+		}
+		s, err := app.snippets.Get(t.Context(), liveID)
+		if err != nil || s.Title != "Edited" || !s.Expires.Equal(live.Expires) {
+			t.Errorf("got %+v, %v; want the edited snippet expiring at %v", s, err, live.Expires)
+		}
+
+		// an expired snippet can be edited, staying expired
+		code, _, body = ts.get(t, fmt.Sprintf("/snippet/edit/%d", expiredID))
+		if code != http.StatusOK || !strings.Contains(body, "Keep expired") {
+			t.Errorf("got status %d; want %d with the option to keep it expired", code, http.StatusOK)
+		}
+
+		code, location = edit(t, csrfToken, expiredID, "0")
+		if code != http.StatusSeeOther || location != "/user/snippets" {
+			t.Errorf("got status %d to %q; want a redirect to the user's snippets", code, location)
+		}
+		s, err = app.snippets.GetIncludingExpired(t.Context(), expiredID)
+		if err != nil || s.Title != "Edited" || !s.Expires.Equal(expired.Expires) {
+			t.Errorf("got %+v, %v; want the edited snippet expiring at %v", s, err, expired.Expires)
+		}
+
+		// or be given a new lifetime
+		code, location = edit(t, csrfToken, expiredID, "7")
+		if code != http.StatusSeeOther || location != fmt.Sprintf("/snippet/view/%d", expiredID) {
+			t.Errorf("got status %d to %q; want a redirect to the snippet", code, location)
+		}
+		if _, err := app.snippets.Get(t.Context(), expiredID); err != nil {
+			t.Errorf("want the snippet to be live again, got %v", err)
+		}
+	})
+
+	t.Run("Author, expired", func(t *testing.T) {
+		expiredID, err := app.snippets.Insert(t.Context(), &models.Snippet{
+			Title:       "Expired",
+			Content:     "gone",
+			ContentType: models.ContentTypeText,
+			UserID:      aliceID,
+		}, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		csrfToken := ts.login(t, "alice@example.com", "pa$$word")
+		code, _, _ := ts.postForm(t, fmt.Sprintf("/snippet/delete/%d", expiredID), url.Values{"csrf_token": {csrfToken}})
+		if code != http.StatusSeeOther {
+			t.Errorf("got status %d deleting; want %d", code, http.StatusSeeOther)
+		}
+		if _, err := app.snippets.GetIncludingExpired(t.Context(), expiredID); !errors.Is(err, models.ErrNoRecord) {
+			t.Errorf("got %v; want the snippet to be deleted", err)
+		}
+	})
+}
+
+func TestSnippetHistory(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	aliceID := signup(t, app, "Alice", "alice@example.com", "pa$$word")
+	signup(t, app, "Bob", "bob@example.com", "pa$$word")
+	id := insertSnippet(t, app, aliceID, "Alice's snippet", "password: hunter2")
+
+	// the pasted secret is edited out, it stays in the first revision
+	err := app.snippets.Update(t.Context(), &models.Snippet{
+		ID:          id,
+		Title:       "Alice's snippet",
+		Content:     "password: from the environment",
+		ContentType: models.ContentTypeText,
+		UserID:      aliceID,
+	}, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history := fmt.Sprintf("/snippet/view/%d/history", id)
+	diff := fmt.Sprintf("/snippet/view/%d/diff", id)
+	prune := fmt.Sprintf("/snippet/view/%d/history/prune", id)
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		code, _, body := ts.get(t, history)
+		if code != http.StatusOK || !strings.Contains(body, "diff with v1") {
+			t.Errorf("got status %d for the history; want %d with both revisions", code, http.StatusOK)
+		}
+		code, _, body = ts.get(t, diff)
+		if code != http.StatusOK || !strings.Contains(body, "hunter2") {
+			t.Errorf("got status %d for the diff; want %d with the old content", code, http.StatusOK)
+		}
+		code, _, _ = ts.get(t, "/snippet/view/999/history")
+		if code != http.StatusNotFound {
+			t.Errorf("got status %d for a missing snippet; want %d", code, http.StatusNotFound)
+		}
+	})
+
+	t.Run("Another user", func(t *testing.T) {
+		csrfToken := ts.login(t, "bob@example.com", "pa$$word")
+
+		code, _, body := ts.get(t, history)
+		if code != http.StatusOK || strings.Contains(body, "Delete past revisions") {
+			t.Errorf("got status %d for the history; want %d without the prune button", code, http.StatusOK)
+		}
+		code, _, _ = ts.postForm(t, prune, url.Values{"csrf_token": {csrfToken}})
+		if code != http.StatusForbidden {
+			t.Errorf("got status %d pruning; want %d", code, http.StatusForbidden)
+		}
+	})
+
+	t.Run("Author", func(t *testing.T) {
+		csrfToken := ts.login(t, "alice@example.com", "pa$$word")
+
+		code, _, body := ts.get(t, history)
+		if code != http.StatusOK || !strings.Contains(body, "Delete past revisions") {
+			t.Errorf("got status %d for the history; want %d with the prune button", code, http.StatusOK)
+		}
+
+		// pruning gets rid of the secret, keeping the current revision
+		code, header, _ := ts.postForm(t, prune, url.Values{"csrf_token": {csrfToken}})
+		if code != http.StatusSeeOther || header.Get("Location") != history {
+			t.Fatalf("got status %d to %q pruning; want a redirect to the history", code, header.Get("Location"))
+		}
+		code, _, body = ts.get(t, diff)
+		if code != http.StatusOK || strings.Contains(body, "hunter2") {
+			t.Errorf("got status %d for the diff; want %d without the old content", code, http.StatusOK)
+		}
+		code, _, body = ts.get(t, history)
+		if code != http.StatusOK || !strings.Contains(body, "past revisions deleted") {
+			t.Errorf("got status %d for the history; want %d with the pruned revisions", code, http.StatusOK)
+		}
+
+		// deleting the snippet deletes its revisions
+		code, _, _ = ts.postForm(t, fmt.Sprintf("/snippet/delete/%d", id), url.Values{"csrf_token": {csrfToken}})
+		if code != http.StatusSeeOther {
+			t.Fatalf("got status %d deleting; want %d", code, http.StatusSeeOther)
+		}
+		revisions, err := app.revisions.ForSnippet(t.Context(), id)
+		if err != nil || len(revisions) != 0 {
+			t.Errorf("got %d revisions, %v after deleting the snippet; want none", len(revisions), err)
+		}
+	})
+}
+
+var newTokenRX = regexp.MustCompile(`<pre><code>([^<]+)</code></pre>`)
+
+func TestAccountTokens(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	aliceID := signup(t, app, "Alice", "alice@example.com", "pa$$word")
+	signup(t, app, "Bob", "bob@example.com", "pa$$word")
+
+	csrfToken := ts.login(t, "alice@example.com", "pa$$word")
+
+	code, _, body := ts.postForm(t, "/account/tokens", url.Values{
+		"csrf_token": {csrfToken},
+		"name":       {"CI build logs"},
+		"scopes":     {models.ScopeRead},
+	})
+	if code != http.StatusOK {
+		t.Fatalf("got status %d creating a token; want %d", code, http.StatusOK)
+	}
+	matches := newTokenRX.FindStringSubmatch(body)
+	if len(matches) < 2 {
+		t.Fatal("want the new token in the body")
+	}
+	plaintext := matches[1]
+	if _, err := app.tokens.Authenticate(t.Context(), plaintext); err != nil {
+		t.Fatalf("authenticating with the new token: %v", err)
+	}
+
+	// the token is only shown once
+	code, _, body = ts.get(t, "/account/tokens")
+	if code != http.StatusOK || !strings.Contains(body, "CI build logs") || strings.Contains(body, plaintext) {
+		t.Errorf("got status %d; want %d listing the token without showing it", code, http.StatusOK)
+	}
+
+	tokens, err := app.tokens.ForUser(t.Context(), aliceID)
+	if err != nil || len(tokens) != 1 {
+		t.Fatalf("got %d tokens, %v; want 1", len(tokens), err)
+	}
+	revoke := fmt.Sprintf("/account/tokens/revoke/%d", tokens[0].ID)
+
+	t.Run("Another user", func(t *testing.T) {
+		csrfToken := ts.login(t, "bob@example.com", "pa$$word")
+
+		code, _, _ := ts.postForm(t, revoke, url.Values{"csrf_token": {csrfToken}})
+		if code != http.StatusNotFound {
+			t.Errorf("got status %d revoking; want %d", code, http.StatusNotFound)
+		}
+		if _, err := app.tokens.Authenticate(t.Context(), plaintext); err != nil {
+			t.Errorf("want the token to still be valid, got %v", err)
+		}
+	})
+
+	t.Run("Owner", func(t *testing.T) {
+		csrfToken := ts.login(t, "alice@example.com", "pa$$word")
+
+		code, header, _ := ts.postForm(t, revoke, url.Values{"csrf_token": {csrfToken}})
+		if code != http.StatusSeeOther || header.Get("Location") != "/account/tokens" {
+			t.Errorf("got status %d to %q revoking; want a redirect to the tokens", code, header.Get("Location"))
+		}
+		if _, err := app.tokens.Authenticate(t.Context(), plaintext); err == nil {
+			t.Error("want the revoked token to be rejected")
+		}
+	})
+}
+
+func TestAPISnippets(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	userID := signup(t, app, "Alice", "alice@example.com", "pa$$word")
+	readToken, _, err := app.tokens.Insert(t.Context(), userID, "read", []string{models.ScopeRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	allToken, _, err := app.tokens.Insert(t.Context(), userID, "all", models.Scopes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bearer := func(token string) http.Header {
+		return http.Header{"Authorization": {"Bearer " + token}}
+	}
+	body := []byte(`{"title": "Hello", "content": "print('hello')", "tags": ["python"], "expires": 7}`)
+
+	code, _, _ := ts.do(t, http.MethodPost, "/api/v1/snippets", "application/json", body, nil)
+	if code != http.StatusUnauthorized {
+		t.Errorf("got status %d without a token; want %d", code, http.StatusUnauthorized)
+	}
+
+	code, _, _ = ts.do(t, http.MethodPost, "/api/v1/snippets", "application/json", body, bearer(readToken))
+	if code != http.StatusForbidden {
+		t.Errorf("got status %d with a read token; want %d", code, http.StatusForbidden)
+	}
+
+	code, header, _ := ts.do(t, http.MethodPost, "/api/v1/snippets", "application/json", body, bearer(allToken))
+	if code != http.StatusCreated {
+		t.Fatalf("got status %d; want %d", code, http.StatusCreated)
+	}
+	location := header.Get("Location")
+
+	code, _, got := ts.get(t, location)
+	if code != http.StatusOK {
+		t.Errorf("got status %d; want %d", code, http.StatusOK)
+	}
+	for _, want := range []string{`"title": "Hello"`, `"python"`, `"author": "Alice"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got body %q; want it to contain %q", got, want)
+		}
+	}
+
+	created, err := app.snippets.ByUser(t.Context(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updates := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantTags   []string
+	}{
+		{"Tag with a space", `{"title": "Hello", "content": "hello", "tags": ["foo bar"]}`, http.StatusUnprocessableEntity, []string{"python"}},
+		{"Upper case tag", `{"title": "Hello", "content": "hello", "tags": ["Python"]}`, http.StatusUnprocessableEntity, []string{"python"}},
+		{"Empty tag", `{"title": "Hello", "content": "hello", "tags": [""]}`, http.StatusUnprocessableEntity, []string{"python"}},
+		{"Too many tags", `{"title": "Hello", "content": "hello", "tags": ["a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"]}`, http.StatusUnprocessableEntity, []string{"python"}},
+		{"Duplicate tags", `{"title": "Hello", "content": "hello", "tags": ["go", "go"]}`, http.StatusOK, []string{"go"}},
+		{"No expiry", `{"title": "Hello", "content": "hello", "tags": ["python", "go"]}`, http.StatusOK, []string{"go", "python"}},
+	}
+	for _, tt := range updates {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, got := ts.do(t, http.MethodPut, location, "application/json", []byte(tt.body), bearer(allToken))
+			if code != tt.wantStatus {
+				t.Errorf("got status %d updating; want %d: %s", code, tt.wantStatus, got)
+			}
+
+			s, err := app.snippets.Get(t.Context(), created[0].ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(s.Tags, tt.wantTags) {
+				t.Errorf("got tags %q; want %q", s.Tags, tt.wantTags)
+			}
+			// updates without expires keep the expiry
+			if !s.Expires.Equal(created[0].Expires) {
+				t.Errorf("got expiry %v; want %v", s.Expires, created[0].Expires)
+			}
+		})
+	}
+
+	code, _, _ = ts.do(t, http.MethodDelete, location, "", nil, bearer(allToken))
+	if code != http.StatusNoContent {
+		t.Errorf("got status %d deleting; want %d", code, http.StatusNoContent)
+	}
+
+	code, _, _ = ts.get(t, location)
+	if code != http.StatusNotFound {
+		t.Errorf("got status %d after deleting; want %d", code, http.StatusNotFound)
+	}
+}
+
+// timeoutSnippets is a snippet store whose queries time out
+type timeoutSnippets struct {
+	models.SnippetStore
+}
+
+func (timeoutSnippets) Get(ctx context.Context, id int) (*models.Snippet, error) {
+	return nil, fmt.Errorf("%w: SnippetModel.Get: context deadline exceeded", models.ErrTimeout)
+}
+
+func TestQueryTimeout(t *testing.T) {
+	app := newTestApplication(t)
+	app.snippets = timeoutSnippets{app.snippets}
+	ts := newTestServer(t, app.routes())
+
+	for _, urlPath := range []string{"/snippet/view/1", "/api/v1/snippets/1"} {
+		t.Run(urlPath, func(t *testing.T) {
+			code, header, _ := ts.get(t, urlPath)
+			if code != http.StatusServiceUnavailable {
+				t.Errorf("got status %d; want %d", code, http.StatusServiceUnavailable)
+			}
+			if header.Get("Retry-After") == "" {
+				t.Error("want a Retry-After header")
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+)
+
+// healthTimeout is the default time given to each check of the health
+// endpoints, so that a hung database fails its check rather than the probe
+// of the load balancer
+const healthTimeout = 2 * time.Second
+
+// healthToken is the session token the session store is asked for, which no
+// session ever has since scs generates tokens of 43 characters
+const healthToken = "healthcheck"
+
+// health holds the dependencies checked by the health endpoints
+type health struct {
+	// db is the connection pool of the SQL backends, nil for the memory one
+	db *sql.DB
+	// sessions is the session store of the backend, not the one counting
+	// its operations in the metrics
+	sessions scs.Store
+	// purger is nil when purging is disabled
+	purger *purger
+	// timeout bounds each check, healthTimeout if 0
+	timeout time.Duration
+
+	// draining is set once shutdown begins, making the application report
+	// not ready
+	draining atomic.Bool
+}
+
+// checkResult is the result of the check of a component, its latency being
+// the time the check took, such as "1.5ms"
+type checkResult struct {
+	Status  string `json:"status"`
+	Latency string `json:"latency"`
+	Error   string `json:"error,omitempty"`
+}
+
+// healthCheck is a named check, returning nil if the component is healthy
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// livenessChecks are the checks of the components of the process itself,
+// which restarting it could fix. They don't include the database: restarting
+// every instance during an outage of the database doesn't help.
+func (app *application) livenessChecks() []healthCheck {
+	checks := []healthCheck{
+		{"templates", app.checkTemplates},
+	}
+	if p := app.health.purger; p != nil {
+		checks = append(checks, healthCheck{"purger", func(context.Context) error {
+			return p.alive()
+		}})
+	}
+	return checks
+}
+
+// readinessChecks are the checks of everything needed to serve requests. A
+// stalled purger makes the application not ready rather than dead, its
+// database being too slow to keep up.
+func (app *application) readinessChecks() []healthCheck {
+	var checks []healthCheck
+	if app.health.db != nil {
+		checks = append(checks, healthCheck{"database", app.health.db.PingContext})
+	}
+	checks = append(checks, healthCheck{"sessions", func(context.Context) error {
+		_, _, err := app.health.sessions.Find(healthToken)
+		return err
+	}})
+	checks = append(checks, healthCheck{"templates", app.checkTemplates})
+	if p := app.health.purger; p != nil {
+		checks = append(checks, healthCheck{"purger", func(context.Context) error {
+			return errors.Join(p.alive(), p.stalled())
+		}})
+	}
+	return checks
+}
+
+// checkTemplates checks that the pages served to everyone, including the
+// error page, have been parsed
+func (app *application) checkTemplates(context.Context) error {
+	for _, page := range []string{"home.tmpl", "error.tmpl"} {
+		if app.templateCache[page] == nil {
+			return errors.New("template " + page + " not loaded")
+		}
+	}
+	return nil
+}
+
+// runChecks runs the checks concurrently, each with the timeout. Checks
+// ignoring their context, like the ones of the session store, are given up
+// on once it's done.
+func (h *health) runChecks(ctx context.Context, checks []healthCheck) (results map[string]checkResult, ok bool) {
+	timeout := h.timeout
+	if timeout == 0 {
+		timeout = healthTimeout
+	}
+
+	results = make(map[string]checkResult, len(checks))
+	ok = true
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Go(func() {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			errs := make(chan error, 1)
+			go func() { errs <- c.check(ctx) }()
+
+			var err error
+			select {
+			case err = <-errs:
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+
+			result := checkResult{
+				Status:  "ok",
+				Latency: time.Since(start).Round(time.Microsecond).String(),
+			}
+			if err != nil {
+				result.Status = "failed"
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[c.name] = result
+			ok = ok && err == nil
+		})
+	}
+	wg.Wait()
+
+	return results, ok
+}
+
+// writeHealth runs the checks and sends their results, with a 503 status if
+// any failed. The errors of the failed checks, which include the ones of the
+// database driver, are only sent if withErrors is set, they're logged anyway.
+func (app *application) writeHealth(w http.ResponseWriter, r *http.Request, checks []healthCheck, withErrors bool) {
+	results, ok := app.health.runChecks(r.Context(), checks)
+
+	status, code := "ok", http.StatusOK
+	if !ok {
+		status, code = "failed", http.StatusServiceUnavailable
+		app.logger.Warn("health check failed", "request_id", requestID(r), "uri", r.URL.RequestURI(), "checks", results)
+	}
+
+	if !withErrors {
+		for name, result := range results {
+			result.Error = ""
+			results[name] = result
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	app.writeJSON(w, code, envelope{"status": status, "checks": results}, nil)
+}
+
+// healthz reports whether the process is alive. A failure means it should
+// be restarted.
+func (app *application) healthz(withErrors bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		app.writeHealth(w, r, app.livenessChecks(), withErrors)
+	}
+}
+
+// readyz reports whether the application can serve requests. A failure
+// means the load balancer should stop sending it traffic, which it must do
+// too once shutdown begins, without running the checks.
+func (app *application) readyz(withErrors bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !app.health.draining.Load() {
+			app.writeHealth(w, r, app.readinessChecks(), withErrors)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		app.writeJSON(w, http.StatusServiceUnavailable, envelope{"status": "draining", "checks": map[string]checkResult{}}, nil)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2/memstore"
+)
+
+// failingStore is a session store whose lookups fail, like one whose
+// database is down
+type failingStore struct {
+	*memstore.MemStore
+}
+
+func (failingStore) Find(token string) ([]byte, bool, error) {
+	return nil, false, errors.New("connection refused")
+}
+
+// hangingStore is a session store whose lookups never return
+type hangingStore struct {
+	*memstore.MemStore
+	release chan struct{}
+}
+
+func (s hangingStore) Find(token string) ([]byte, bool, error) {
+	<-s.release
+	return nil, false, nil
+}
+
+func TestHealth(t *testing.T) {
+	tests := []struct {
+		name       string
+		urlPath    string
+		setup      func(t *testing.T, app *application)
+		wantStatus int
+		wantBody   string
+		wantFailed string
+	}{
+		{
+			name:       "Alive",
+			urlPath:    "/healthz",
+			wantStatus: http.StatusOK,
+			wantBody:   "ok",
+		},
+		{
+			name:       "Ready",
+			urlPath:    "/readyz",
+			wantStatus: http.StatusOK,
+			wantBody:   "ok",
+		},
+		{
+			name:    "Session store down",
+			urlPath: "/readyz",
+			setup: func(t *testing.T, app *application) {
+				app.health.sessions = failingStore{memstore.New()}
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "failed",
+			wantFailed: "sessions",
+		},
+		{
+			name:    "Session store hanging",
+			urlPath: "/readyz",
+			setup: func(t *testing.T, app *application) {
+				release := make(chan struct{})
+				t.Cleanup(func() { close(release) })
+				app.health.sessions = hangingStore{memstore.New(), release}
+				app.health.timeout = 10 * time.Millisecond
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "failed",
+			wantFailed: "sessions",
+		},
+		{
+			name:    "Session store down, alive anyway",
+			urlPath: "/healthz",
+			setup: func(t *testing.T, app *application) {
+				app.health.sessions = failingStore{memstore.New()}
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "ok",
+		},
+		{
+			name:    "Template missing",
+			urlPath: "/healthz",
+			setup: func(t *testing.T, app *application) {
+				delete(app.templateCache, "error.tmpl")
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "failed",
+			wantFailed: "templates",
+		},
+		{
+			name:    "Purger stopped",
+			urlPath: "/readyz",
+			setup: func(t *testing.T, app *application) {
+				app.health.purger = &purger{interval: time.Hour}
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "failed",
+			wantFailed: "purger",
+		},
+		{
+			name:    "Purger stalled",
+			urlPath: "/readyz",
+			setup: func(t *testing.T, app *application) {
+				app.health.purger = stalledPurger()
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "failed",
+			wantFailed: "purger",
+		},
+		{
+			name:    "Purger stalled, alive anyway",
+			urlPath: "/healthz",
+			setup: func(t *testing.T, app *application) {
+				app.health.purger = stalledPurger()
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "ok",
+		},
+		{
+			name:    "Draining",
+			urlPath: "/readyz",
+			setup: func(t *testing.T, app *application) {
+				app.health.draining.Store(true)
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "draining",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			if tt.setup != nil {
+				tt.setup(t, app)
+			}
+
+			// the load balancer gets the same results, without the errors
+			for _, listener := range []struct {
+				name       string
+				handler    http.Handler
+				withErrors bool
+			}{
+				{"public", app.routes(), false},
+				{"admin", app.adminRoutes(), true},
+			} {
+				rr := httptest.NewRecorder()
+				listener.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.urlPath, nil))
+				if rr.Code != tt.wantStatus {
+					t.Errorf("got status %d on the %s listener; want %d", rr.Code, listener.name, tt.wantStatus)
+				}
+				if got := rr.Header().Get("Cache-Control"); got != "no-store" {
+					t.Errorf("got Cache-Control %q on the %s listener; want %q", got, listener.name, "no-store")
+				}
+
+				var rs struct {
+					Status string                 `json:"status"`
+					Checks map[string]checkResult `json:"checks"`
+				}
+				if err := json.Unmarshal(rr.Body.Bytes(), &rs); err != nil {
+					t.Fatalf("decoding %q: %v", rr.Body, err)
+				}
+				if rs.Status != tt.wantBody {
+					t.Errorf("got status %q on the %s listener; want %q", rs.Status, listener.name, tt.wantBody)
+				}
+				if rs.Checks == nil {
+					t.Errorf("got no checks on the %s listener", listener.name)
+				}
+				for name, c := range rs.Checks {
+					wantStatus := "ok"
+					if name == tt.wantFailed {
+						wantStatus = "failed"
+					}
+					if c.Status != wantStatus {
+						t.Errorf("got %s status %q (%s) on the %s listener; want %q", name, c.Status, c.Error, listener.name, wantStatus)
+					}
+					if _, err := time.ParseDuration(c.Latency); err != nil {
+						t.Errorf("got %s latency %q on the %s listener: %v", name, c.Latency, listener.name, err)
+					}
+					if c.Error != "" && !listener.withErrors {
+						t.Errorf("got %s error %q on the %s listener; want none", name, c.Error, listener.name)
+					}
+				}
+				if tt.wantFailed != "" && listener.withErrors && rs.Checks[tt.wantFailed].Error == "" {
+					t.Errorf("want the error of %s on the %s listener", tt.wantFailed, listener.name)
+				}
+			}
+		})
+	}
+}
+
+// stalledPurger returns a running purger which made no progress for three
+// intervals
+func stalledPurger() *purger {
+	p := &purger{interval: time.Minute}
+	p.running.Store(true)
+	p.heartbeat.Store(time.Now().Add(-3 * time.Minute).UnixNano())
+	return p
+}
@@ -5,48 +5,41 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"runtime/debug"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/go-playground/form/v4"
 	"github.com/justinas/nosurf"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"snippetbox.cnoua.org/internal/highlight"
+	"snippetbox.cnoua.org/internal/models"
 )
 
-// serverError writes an error message & stack trace to the errorLog
-// then sends a generic 500 Internal Server Error response to the user
-func (app *application) serverError(w http.ResponseWriter, err error) {
-	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
-	app.errorLog.Output(2, trace)
-}
-
-// clientError sends a specific status code & description to the user
-func (app *application) clientError(w http.ResponseWriter, status int) {
-	http.Error(w, http.StatusText(status), status)
-}
-
-// convenience wrapper around clientError which sends a 404 to the user
-func (app *application) notFound(w http.ResponseWriter) {
-	app.clientError(w, http.StatusNotFound)
-}
-
 // helper which returns a pointer to a templateData struct initialized without
 // the current year
 func (app *application) newTemplateData(r *http.Request) *templateData {
 	return &templateData{
-		CurrentYear:     time.Now().Year(),
-		Flash:           app.sessionManager.PopString(r.Context(), "flash"),
-		IsAuthenticated: app.isAuthenticated(r),
-		CSRFToken:       nosurf.Token(r),
+		CurrentYear:         time.Now().Year(),
+		Flash:               app.sessionManager.PopString(r.Context(), "flash"),
+		IsAuthenticated:     app.isAuthenticated(r),
+		AuthenticatedUserID: app.authenticatedUserID(r),
+		CSRFToken:           nosurf.Token(r),
 	}
 }
 
-func (app *application) render(w http.ResponseWriter, status int, page string, data *templateData) {
+func (app *application) render(w http.ResponseWriter, r *http.Request, status int, page string, data *templateData) {
 	// retrieve template set from cache based on the page name, if no entry exists
 	// create a new error & call serverError() helper method
 	ts, ok := app.templateCache[page]
 	if !ok {
 		err := fmt.Errorf("the template %s does not exist", page)
-		app.serverError(w, err)
+		app.metrics.renderErrors.WithLabelValues(page).Inc()
+		app.serverError(w, r, err)
 		return
 	}
 
@@ -54,9 +47,16 @@ func (app *application) render(w http.ResponseWriter, status int, page string, d
 	buf := new(bytes.Buffer)
 
 	// write template to buffer, if there's an error call serverError()
+	_, span := app.tracer().Start(r.Context(), "render "+page, trace.WithAttributes(attribute.String("template", page)))
 	err := ts.ExecuteTemplate(buf, "base", data)
 	if err != nil {
-		app.serverError(w, err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+	if err != nil {
+		app.metrics.renderErrors.WithLabelValues(page).Inc()
+		app.serverError(w, r, err)
 		return
 	}
 
@@ -101,3 +101,71 @@ func (app *application) isAuthenticated(r *http.Request) bool {
 	}
 	return isAuthenticated
 }
+
+// authenticatedUserID returns the ID of the user making the current request,
+// or 0 if the request is not authenticated
+func (app *application) authenticatedUserID(r *http.Request) int {
+	id, ok := r.Context().Value(authenticatedUserIDContextKey).(int)
+	if !ok {
+		return 0
+	}
+	return id
+}
+
+// parseTags splits a list of tags separated by commas or spaces, as typed in
+// a form, into lowercase tag names without duplicates
+func parseTags(s string) []string {
+	tags := []string{}
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	for _, tag := range fields {
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// normalizeEmail returns an email address as stored with users: trimmed and
+// lower-cased, so that it matches whatever its case, PostgreSQL and SQLite
+// comparing strings case sensitively
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// snippetFilename returns the name a snippet is downloaded as: its title
+// reduced to lowercase letters, digits, dots and dashes, followed by the
+// extension of its language unless the title already ends with one
+func snippetFilename(s *models.Snippet) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s.Title) {
+		if ('a' <= r && r <= 'z') || ('0' <= r && r <= '9') || r == '.' || r == '_' {
+			if dash && sb.Len() > 0 {
+				sb.WriteByte('-')
+			}
+			sb.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+
+	name := strings.Trim(sb.String(), ".")
+	if name == "" {
+		name = fmt.Sprintf("snippet-%d", s.ID)
+	}
+	if fileExtRX.MatchString(name) {
+		return name
+	}
+
+	if s.ContentType == models.ContentTypeMarkdown {
+		return name + ".md"
+	}
+	return name + highlight.Extension(s.Language)
+}
+
+// fileExtRX matches names ending with something looking like a file
+// extension, e.g. "main.go" but not "v1.2-notes"
+var fileExtRX = regexp.MustCompile(`\.[a-z][a-z0-9]{0,9}$`)
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"snippetbox.cnoua.org/internal/models"
+)
+
+func TestSnippetFilename(t *testing.T) {
+	tests := []struct {
+		name    string
+		snippet models.Snippet
+		want    string
+	}{
+		{
+			name:    "Title and language",
+			snippet: models.Snippet{Title: "Deploy the app!", Language: "bash"},
+			want:    "deploy-the-app.sh",
+		},
+		{
+			name:    "Title with a file name",
+			snippet: models.Snippet{Title: "main.go", Language: "go"},
+			want:    "main.go",
+		},
+		{
+			name:    "Plain text",
+			snippet: models.Snippet{Title: "Notes on v1.2 release"},
+			want:    "notes-on-v1.2-release.txt",
+		},
+		{
+			name:    "Markdown",
+			snippet: models.Snippet{Title: "How to", Language: "go", ContentType: models.ContentTypeMarkdown},
+			want:    "how-to.md",
+		},
+		{
+			name:    "Nothing left of the title",
+			snippet: models.Snippet{ID: 7, Title: "«»", Language: "sql"},
+			want:    "snippet-7.sql",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := snippetFilename(&tt.snippet)
+			if got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want []string
+	}{
+		{"Empty", "", []string{}},
+		{"Commas", "sql,runbook", []string{"sql", "runbook"}},
+		{"Commas and spaces", " sql, runbook  shell ", []string{"sql", "runbook", "shell"}},
+		{"Lower-cased", "SQL, RunBook", []string{"sql", "runbook"}},
+		{"Duplicates", "sql, runbook, Sql", []string{"sql", "runbook"}},
+		{"Empty items", "sql,, ,runbook,", []string{"sql", "runbook"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseTags(tt.s)
+			if !slices.Equal(got, tt.want) || got == nil {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
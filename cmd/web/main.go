@@ -1,76 +1,151 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
-	"database/sql"
+	"errors"
 	"flag"
+	"fmt"
 	"html/template"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"snippetbox.cnoua.org/internal/config"
 	// import our models package
 	"snippetbox.cnoua.org/internal/models"
 
-	"github.com/alexedwards/scs/mysqlstore"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
-	_ "github.com/go-sql-driver/mysql" // alias package name to the blank identifier
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type application struct {
-	errorLog       *log.Logger
-	infoLog        *log.Logger
-	snippets       *models.SnippetModel
-	users          *models.UserModel
+	logger         *slog.Logger
+	metrics        *metrics
+	health         *health
+	snippets       models.SnippetStore
+	revisions      models.RevisionStore
+	users          models.UserStore
+	tokens         models.TokenStore
 	templateCache  map[string]*template.Template
+	staticDir      string
 	formDecoder    *form.Decoder
 	sessionManager *scs.SessionManager
+
+	// the spans and the incoming trace context go through the global tracer
+	// provider and propagator when these are nil, tests set their own
+	tracerProvider trace.TracerProvider
+	propagator     propagation.TextMapPropagator
 }
 
 func main() {
-	addr := flag.String("addr", ":4000", "HTTP network address")
-	// define a new flag for the MySQL DSN String
-	dsn := flag.String("dsn", "web:matrix@/snippetbox?parseTime=true", "MySQL data source name")
+	// read the settings from the file, the environment and the flags
+	cfg, err := config.Load(os.Args[0], os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	// the flag package already reported invalid arguments
+	if errors.Is(err, config.ErrUsage) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if cfg.PrintConfig {
+		cfg.Write(os.Stdout)
+		return
+	}
+
+	logger := newLogger(os.Stdout, cfg.Log)
 
-	flag.Parse()
+	// run() returns rather than exiting on errors, so that its deferred calls
+	// close the backend. The exit status tells a clean shutdown apart from a
+	// failure.
+	if err := run(cfg, logger); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+}
 
-	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+// newLogger returns a structured logger writing to w in the format and from
+// the level of the configuration, which Validate() has already checked
+func newLogger(w io.Writer, cfg config.Log) *slog.Logger {
+	var level slog.Level
+	level.UnmarshalText([]byte(cfg.Level))
+
+	opts := &slog.HandlerOptions{Level: level}
+	if cfg.Format == "text" {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+// run starts the application and serves requests until SIGINT or SIGTERM is
+// received
+func run(cfg *config.Config, logger *slog.Logger) error {
+	// export the traces of the requests, the templates and the queries. The
+	// spans left are flushed once everything else is closed.
+	shutdownTracing, err := setupTracing(cfg.Tracing)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error("flushing traces", "error", err)
+		}
+	}()
 
-	// create a connection pool
-	db, err := openDB(*dsn)
+	// open the storage backend of the models and the sessions
+	store, err := openBackend(cfg, logger)
 	if err != nil {
-		errorLog.Fatal(err)
+		return err
+	}
+	// defer closing the backend, so the connection pool closes before run() returns
+	defer store.close()
+
+	// count the requests, the panics, the render failures and the session
+	// store operations, along with the statistics of the connection pool
+	metrics := newMetrics()
+	if store.db != nil {
+		metrics.registerDB(store.db, cfg.DB.Backend)
 	}
-	// defer a call to db.Close() so connection pool closes before main() exits
-	defer db.Close()
 
 	// initialize a new template cache
-	templateCache, err := newTemplateCache()
+	templateCache, err := newTemplateCache(cfg.UI.TemplatesDir)
 	if err != nil {
-		errorLog.Fatal(err)
+		return err
 	}
 
 	// initialize a decoder instance
 	formDecoder := form.NewDecoder()
 
-	// initialize a session manager, configure it to use mysql as session store
-	// set a lifetime of 12 hours (session expire)
+	// initialize a session manager, configure it to use the session store
+	// of the backend, and set its lifetime (session expire)
 	sessionManager := scs.New()
-	sessionManager.Store = mysqlstore.New(db)
-	sessionManager.Lifetime = 12 * time.Hour
+	sessionManager.Store = metrics.instrumentSessions(store.sessions)
+	sessionManager.Lifetime = cfg.Session.Lifetime
 	// cookie will only be sent over HTTPS
 	sessionManager.Cookie.Secure = true
 
-	// initialize a models.SnippetModel instance and add it to the application dependencies
 	app := &application{
-		errorLog:       errorLog,
-		infoLog:        infoLog,
-		snippets:       &models.SnippetModel{DB: db},
-		users:          &models.UserModel{DB: db},
+		logger:         logger,
+		metrics:        metrics,
+		health:         &health{db: store.db, sessions: store.sessions},
+		snippets:       store.snippets,
+		revisions:      store.revisions,
+		users:          store.users,
+		tokens:         store.tokens,
 		templateCache:  templateCache,
+		staticDir:      cfg.UI.StaticDir,
 		formDecoder:    formDecoder,
 		sessionManager: sessionManager,
 	}
@@ -81,30 +156,80 @@ func main() {
 	tlsConfig := &tls.Config{
 		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
 	}
+	// the server logs the errors of the connections through the logger
 	srv := &http.Server{
-		Addr:         *addr,
-		ErrorLog:     errorLog,
+		Addr:         cfg.Addr,
+		ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelError),
 		Handler:      app.routes(),
 		TLSConfig:    tlsConfig,
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
 	}
 
-	infoLog.Printf("Starting server on %s", *addr)
-	// start HTTPS server and pass TLS cert & private key
-	err = srv.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem")
-	errorLog.Fatal(err)
-}
+	// serve the metrics on the admin listener, apart from the public server
+	if cfg.AdminAddr != "" {
+		stopAdmin, err := startAdmin(cfg.AdminAddr, app.adminRoutes(), logger)
+		if err != nil {
+			return err
+		}
+		defer stopAdmin()
+	}
 
-// openDB() wraps sql.Open() and returns a sql.DB connection pool for a given DSN
-func openDB(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		return nil, err
+	// purge the expired snippets in the background, until the server stops
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	waitPurger := func() {}
+	if cfg.Purge.Interval > 0 {
+		app.health.purger = &purger{
+			snippets:  store.snippets,
+			logger:    logger,
+			interval:  cfg.Purge.Interval,
+			retention: cfg.Purge.Retention,
+			batchSize: cfg.Purge.Batch,
+		}
+		waitPurger = app.health.purger.start(workerCtx)
 	}
-	if err = db.Ping(); err != nil {
-		return nil, err
+
+	// pick up the snippets changed by the other instances in the search index
+	waitRefresher := func() {}
+	if store.index != nil && cfg.Search.RefreshInterval > 0 {
+		refresher := &indexRefresher{
+			snippets: store.index,
+			logger:   logger,
+			interval: cfg.Search.RefreshInterval,
+			since:    store.indexed,
+		}
+		waitRefresher = refresher.start(workerCtx)
 	}
-	return db, nil
+
+	// shut down on SIGINT (Ctrl-C) or SIGTERM (deploys). The default behavior
+	// is restored once a signal is caught, so a second one kills the process
+	// right away.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	// once a signal is caught, /readyz reports draining and the server keeps
+	// serving for the drain delay, so the load balancer stops sending
+	// traffic before connections are refused
+	serveCtx, stopServing := context.WithCancel(context.Background())
+	defer stopServing()
+	context.AfterFunc(ctx, func() {
+		app.health.draining.Store(true)
+		logger.Info("Draining server, reporting not ready", "delay", cfg.Server.DrainDelay)
+		time.AfterFunc(cfg.Server.DrainDelay, stopServing)
+	})
+
+	logger.Info("Starting server", "addr", cfg.Addr)
+	// start HTTPS server and pass TLS cert & private key
+	err = serve(serveCtx, srv, func() error {
+		return srv.ListenAndServeTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+	}, cfg.Server.ShutdownTimeout, logger)
+
+	// let a purge in progress finish its batch before closing the backend
+	stopWorkers()
+	waitPurger()
+	waitRefresher()
+
+	return err
 }
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// unmatchedRoute labels the requests matching no route, like the 404 and
+// 405 responses of the router
+const unmatchedRoute = "unmatched"
+
+// metrics holds the Prometheus metrics of the application, in a registry of
+// their own rather than the global one so tests can create as many as they
+// need
+type metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	panics          prometheus.Counter
+	renderErrors    *prometheus.CounterVec
+	sessionOps      *prometheus.CounterVec
+}
+
+// newMetrics registers the metrics of the application along with the ones of
+// the Go runtime and the process
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "snippetbox_http_requests_total",
+			Help: "Number of HTTP requests handled, by route pattern, method and status code.",
+		}, []string{"route", "method", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "snippetbox_http_request_duration_seconds",
+			Help:    "Time taken to handle HTTP requests, by route pattern and method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		panics: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "snippetbox_http_panics_total",
+			Help: "Number of panics recovered while handling HTTP requests.",
+		}),
+		renderErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "snippetbox_template_render_errors_total",
+			Help: "Number of HTML pages which failed to render, by template.",
+		}, []string{"page"}),
+		sessionOps: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "snippetbox_session_store_operations_total",
+			Help: "Number of operations on the session store, by operation and result.",
+		}, []string{"operation", "result"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.panics,
+		m.renderErrors,
+		m.sessionOps,
+	)
+
+	return m
+}
+
+// registerDB adds the statistics of the connection pool of a SQL backend,
+// labelled with the name of the backend
+func (m *metrics) registerDB(db *sql.DB, name string) {
+	m.registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// handler serves the metrics in the Prometheus text format
+func (m *metrics) handler(logger *slog.Logger) http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{
+		ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelError),
+	})
+}
+
+// instrument counts the requests and measures the time they take, labelled
+// with the pattern of the route they matched rather than their URL, which
+// would make a new series for every snippet. It must come after
+// assignRequestID in the chain, the route being recorded in the request
+// info.
+func (app *application) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &responseRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rw, r)
+
+		if rw.status == 0 {
+			rw.status = http.StatusOK
+		}
+
+		route := unmatchedRoute
+		if info, ok := r.Context().Value(requestInfoContextKey).(*requestInfo); ok && info.route != "" {
+			route = info.route
+		}
+
+		app.metrics.requests.WithLabelValues(route, r.Method, strconv.Itoa(rw.status)).Inc()
+		app.metrics.requestDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// instrumentedStore wraps a session store to count its operations and their
+// failures. It implements scs.CtxStore whatever the store, so that the
+// contexts of the requests reach the stores which take them.
+type instrumentedStore struct {
+	scs.Store
+	ops *prometheus.CounterVec
+}
+
+func (s *instrumentedStore) observe(operation string, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	s.ops.WithLabelValues(operation, result).Inc()
+}
+
+func (s *instrumentedStore) Find(token string) ([]byte, bool, error) {
+	b, found, err := s.Store.Find(token)
+	s.observe("find", err)
+	return b, found, err
+}
+
+func (s *instrumentedStore) Commit(token string, b []byte, expiry time.Time) error {
+	err := s.Store.Commit(token, b, expiry)
+	s.observe("commit", err)
+	return err
+}
+
+func (s *instrumentedStore) Delete(token string) error {
+	err := s.Store.Delete(token)
+	s.observe("delete", err)
+	return err
+}
+
+func (s *instrumentedStore) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
+	cs, ok := s.Store.(scs.CtxStore)
+	if !ok {
+		return s.Find(token)
+	}
+	b, found, err := cs.FindCtx(ctx, token)
+	s.observe("find", err)
+	return b, found, err
+}
+
+func (s *instrumentedStore) CommitCtx(ctx context.Context, token string, b []byte, expiry time.Time) error {
+	cs, ok := s.Store.(scs.CtxStore)
+	if !ok {
+		return s.Commit(token, b, expiry)
+	}
+	err := cs.CommitCtx(ctx, token, b, expiry)
+	s.observe("commit", err)
+	return err
+}
+
+func (s *instrumentedStore) DeleteCtx(ctx context.Context, token string) error {
+	cs, ok := s.Store.(scs.CtxStore)
+	if !ok {
+		return s.Delete(token)
+	}
+	err := cs.DeleteCtx(ctx, token)
+	s.observe("delete", err)
+	return err
+}
+
+// instrumentedIterableStore is an instrumentedStore of a store which
+// supports iteration, with or without a context
+type instrumentedIterableStore struct {
+	*instrumentedStore
+}
+
+func (s instrumentedIterableStore) All() (map[string][]byte, error) {
+	return s.AllCtx(context.Background())
+}
+
+func (s instrumentedIterableStore) AllCtx(ctx context.Context) (map[string][]byte, error) {
+	var sessions map[string][]byte
+	var err error
+	if is, ok := s.Store.(scs.IterableCtxStore); ok {
+		sessions, err = is.AllCtx(ctx)
+	} else {
+		sessions, err = s.Store.(scs.IterableStore).All()
+	}
+	s.observe("all", err)
+	return sessions, err
+}
+
+// instrumentSessions returns store counting its operations in the metrics.
+// The returned store supports iteration if store does.
+func (m *metrics) instrumentSessions(store scs.Store) scs.Store {
+	s := &instrumentedStore{Store: store, ops: m.sessionOps}
+	switch store.(type) {
+	case scs.IterableStore, scs.IterableCtxStore:
+		return instrumentedIterableStore{s}
+	}
+	return s
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/alexedwards/scs/v2/memstore"
+)
+
+// scrape returns the metrics of app in the Prometheus text format
+func scrape(t *testing.T, app *application) string {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	app.adminRoutes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d scraping the metrics; want %d", rr.Code, http.StatusOK)
+	}
+
+	b, err := io.ReadAll(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestMetrics(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	ts.get(t, "/ping")
+	ts.get(t, "/ping")
+	ts.get(t, "/snippet/view/1234")
+	ts.get(t, "/missing")
+
+	// a template which doesn't exist fails to render
+	app.render(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, "missing.tmpl", nil)
+
+	sessions := app.metrics.instrumentSessions(memstore.New())
+	sessions.Commit("token", []byte("data"), time.Now().Add(time.Hour))
+	sessions.Find("token")
+
+	metrics := scrape(t, app)
+
+	for _, want := range []string{
+		`snippetbox_http_requests_total{code="200",method="GET",route="/ping"} 2`,
+		`snippetbox_http_requests_total{code="404",method="GET",route="/snippet/view/:id"} 1`,
+		`snippetbox_http_requests_total{code="404",method="GET",route="unmatched"} 1`,
+		`snippetbox_http_request_duration_seconds_count{method="GET",route="/ping"} 2`,
+		`snippetbox_template_render_errors_total{page="missing.tmpl"} 1`,
+		`snippetbox_session_store_operations_total{operation="commit",result="ok"} 1`,
+		`snippetbox_session_store_operations_total{operation="find",result="ok"} 1`,
+		`snippetbox_http_panics_total 0`,
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("want the metrics to contain %q", want)
+		}
+	}
+}
+
+// ctxStore is a session store taking contexts, which records the last one
+// it was given
+type ctxStore struct {
+	*memstore.MemStore
+	ctx context.Context
+}
+
+func (s *ctxStore) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
+	s.ctx = ctx
+	return s.Find(token)
+}
+
+func (s *ctxStore) CommitCtx(ctx context.Context, token string, b []byte, expiry time.Time) error {
+	s.ctx = ctx
+	return s.Commit(token, b, expiry)
+}
+
+func (s *ctxStore) DeleteCtx(ctx context.Context, token string) error {
+	s.ctx = ctx
+	return s.Delete(token)
+}
+
+func (s *ctxStore) AllCtx(ctx context.Context) (map[string][]byte, error) {
+	s.ctx = ctx
+	return s.All()
+}
+
+// plainStore is a session store supporting neither contexts nor iteration
+type plainStore struct {
+	scs.Store
+}
+
+type ctxKey struct{}
+
+func TestInstrumentSessions(t *testing.T) {
+	t.Run("Context store", func(t *testing.T) {
+		app := newTestApplication(t)
+		inner := &ctxStore{MemStore: memstore.New()}
+		sessions, ok := app.metrics.instrumentSessions(inner).(scs.CtxStore)
+		if !ok {
+			t.Fatal("want the instrumented store to take contexts")
+		}
+
+		ctx := context.WithValue(t.Context(), ctxKey{}, "request")
+		if err := sessions.CommitCtx(ctx, "token", []byte("data"), time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if inner.ctx != ctx {
+			t.Error("want the context passed to the store")
+		}
+
+		all, err := sessions.(scs.IterableCtxStore).AllCtx(ctx)
+		if err != nil || len(all) != 1 {
+			t.Errorf("got %d sessions, %v; want 1", len(all), err)
+		}
+
+		metrics := scrape(t, app)
+		for _, want := range []string{
+			`snippetbox_session_store_operations_total{operation="commit",result="ok"} 1`,
+			`snippetbox_session_store_operations_total{operation="all",result="ok"} 1`,
+		} {
+			if !strings.Contains(metrics, want) {
+				t.Errorf("want the metrics to contain %q", want)
+			}
+		}
+	})
+
+	t.Run("Iterable store", func(t *testing.T) {
+		app := newTestApplication(t)
+		sessions := app.metrics.instrumentSessions(memstore.New())
+
+		// the contexts are dropped for the stores which don't take any
+		err := sessions.(scs.CtxStore).CommitCtx(t.Context(), "token", []byte("data"), time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		all, err := sessions.(scs.IterableStore).All()
+		if err != nil || len(all) != 1 {
+			t.Errorf("got %d sessions, %v; want 1", len(all), err)
+		}
+		if metrics := scrape(t, app); !strings.Contains(metrics, `snippetbox_session_store_operations_total{operation="commit",result="ok"} 1`) {
+			t.Error("want the commit counted once")
+		}
+	})
+
+	t.Run("Plain store", func(t *testing.T) {
+		app := newTestApplication(t)
+		sessions := app.metrics.instrumentSessions(plainStore{memstore.New()})
+
+		if _, ok := sessions.(scs.IterableStore); ok {
+			t.Error("want the instrumented store not to support iteration")
+		}
+	})
+}
@@ -2,10 +2,16 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
 	"net/http"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/justinas/nosurf"
+	"snippetbox.cnoua.org/internal/models"
 )
 
 func secureHeaders(next http.Handler) http.Handler {
@@ -20,11 +26,90 @@ func secureHeaders(next http.Handler) http.Handler {
 	})
 }
 
+// requestIDHeader carries the ID of a request, from the proxies in front of
+// the application and back to the client
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID matches the request IDs accepted from clients, the others
+// are replaced so they can't mess up the logs
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// assignRequestID gives every request an ID, the one of the X-Request-ID header
+// when it is valid or a random one otherwise. The ID is stored in the request
+// context and echoed in the X-Request-ID response header.
+func assignRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = rand.Text()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), requestInfoContextKey, &requestInfo{id: id})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// responseRecorder wraps a http.ResponseWriter to record the status code and
+// the size of the response
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rw *responseRecorder) WriteHeader(status int) {
+	// informational responses are followed by the final one
+	if rw.status == 0 && status >= 200 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the features of the wrapped
+// http.ResponseWriter, like flushing
+func (rw *responseRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// logRequest writes the access log line of a request once it has been
+// handled, with the response status and size, the time it took and the
+// authenticated user if any. It must come after assignRequestID in the chain.
 func (app *application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		app.infoLog.Printf("%s - %s %s %s", r.RemoteAddr, r.Proto, r.Method, r.URL.RequestURI())
+		start := time.Now()
+		rw := &responseRecorder{ResponseWriter: w}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(rw, r)
+
+		// net/http sends a 200 OK when the handler writes nothing
+		if rw.status == 0 {
+			rw.status = http.StatusOK
+		}
+
+		attrs := []any{
+			"request_id", requestID(r),
+			"remote_addr", r.RemoteAddr,
+			"proto", r.Proto,
+			"method", r.Method,
+			"uri", r.URL.RequestURI(),
+			"status", rw.status,
+			"bytes", rw.bytes,
+			"duration", time.Since(start),
+		}
+		if info, ok := r.Context().Value(requestInfoContextKey).(*requestInfo); ok && info.userID != 0 {
+			attrs = append(attrs, "user_id", info.userID)
+		}
+		app.logger.Info("request", attrs...)
 	})
 }
 
@@ -35,10 +120,11 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 		defer func() {
 			// use the built-in recover fn to check if there's been a panic or not
 			if err := recover(); err != nil {
+				app.metrics.panics.Inc()
 				// set a "Connection: close" header in the response
 				w.Header().Set("Connection", "close")
 				// return a 500 error
-				app.serverError(w, fmt.Errorf("%s", err))
+				app.serverError(w, r, fmt.Errorf("%s", err))
 			}
 		}()
 		next.ServeHTTP(w, r)
@@ -65,14 +151,18 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 }
 
 // noSurf uses a customized CSRF cookie with the Secure, Path
-// and HttpOnly attributes set.
-func noSurf(next http.Handler) http.Handler {
+// and HttpOnly attributes set. Requests failing the CSRF check get the
+// 400 Bad Request error page.
+func (app *application) noSurf(next http.Handler) http.Handler {
 	csrfHandler := nosurf.New(next)
 	csrfHandler.SetBaseCookie(http.Cookie{
 		HttpOnly: true,
 		Path:     "/",
 		Secure:   true,
 	})
+	csrfHandler.SetFailureHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.clientError(w, r, http.StatusBadRequest)
+	}))
 
 	return csrfHandler
 }
@@ -89,17 +179,19 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		}
 
 		// otherwise, we check to see if a user with that ID exists in our db
-		exists, err := app.users.Exists(id)
+		exists, err := app.users.Exists(r.Context(), id)
 		if err != nil {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 			return
 		}
 
 		// if auser is found we know the request is coming from an authenticated
 		// user. We create a new copy of the request with an isAuthenticatedContextKey
-		// value of true in the request context and assign it to r
+		// value of true and the user's ID in the request context and assign it to r
 		if exists {
+			setRequestUserID(r, id)
 			ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+			ctx = context.WithValue(ctx, authenticatedUserIDContextKey, id)
 			r = r.WithContext(ctx)
 		}
 
@@ -107,3 +199,66 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// authenticateAPI authenticates API requests from the personal API token of
+// an "Authorization: Bearer" header, and fills the request context the same
+// way as authenticate, along with the token itself so its scopes can be
+// checked. Requests without a token carry on unauthenticated, invalid tokens
+// get a 401 Unauthorized response.
+func (app *application) authenticateAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the response depends on the Authorization header
+		w.Header().Add("Vary", "Authorization")
+
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		scheme, plaintext, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			app.apiUnauthorized(w, r, "invalid or missing authentication token")
+			return
+		}
+
+		token, err := app.tokens.Authenticate(r.Context(), strings.TrimSpace(plaintext))
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidCredentials) {
+				app.apiUnauthorized(w, r, "invalid or missing authentication token")
+			} else {
+				app.apiServerError(w, r, err)
+			}
+			return
+		}
+
+		setRequestUserID(r, token.UserID)
+		ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+		ctx = context.WithValue(ctx, authenticatedUserIDContextKey, token.UserID)
+		ctx = context.WithValue(ctx, apiTokenContextKey, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requireScope is the API counterpart of requireAuthentication. It sends a
+// 401 Unauthorized JSON response to unauthenticated requests, and a 403
+// Forbidden one when the API token doesn't grant the given scope.
+func (app *application) requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := r.Context().Value(apiTokenContextKey).(*models.Token)
+			if !ok {
+				app.apiUnauthorized(w, r, "you must be authenticated to access this resource")
+				return
+			}
+			if !token.HasScope(scope) {
+				app.apiError(w, r, http.StatusForbidden, fmt.Sprintf("your token doesn't have the %q scope", scope))
+				return
+			}
+
+			w.Header().Add("Cache-Control", "no-store")
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
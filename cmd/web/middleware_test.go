@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"snippetbox.cnoua.org/internal/models"
+)
+
+func TestRequireScope(t *testing.T) {
+	app := &application{}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	handler := app.requireScope(models.ScopeWrite)(next)
+
+	tests := []struct {
+		name       string
+		token      *models.Token
+		wantStatus int
+	}{
+		{
+			name:       "No token",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Missing scope",
+			token:      &models.Token{Scopes: []string{models.ScopeRead}},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Granted scope",
+			token:      &models.Token{Scopes: []string{models.ScopeRead, models.ScopeWrite}},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/snippets", nil)
+			if tt.token != nil {
+				r = r.WithContext(context.WithValue(r.Context(), apiTokenContextKey, tt.token))
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("got status %d; want %d", rr.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") == "" {
+				t.Error("want a WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestAssignRequestID(t *testing.T) {
+	var got string
+	handler := assignRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = requestID(r)
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{name: "No header"},
+		{name: "Valid header", header: "3f2a9c1e-proxy.42", keep: true},
+		{name: "Invalid header", header: "id\nINFO forged log line"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Request-ID", tt.header)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r)
+
+			if got == "" || !validRequestID.MatchString(got) {
+				t.Fatalf("got request ID %q", got)
+			}
+			if tt.keep && got != tt.header {
+				t.Errorf("got request ID %q; want %q", got, tt.header)
+			}
+			if !tt.keep && got == tt.header {
+				t.Errorf("got request ID %q; want a generated one", got)
+			}
+			if h := rr.Header().Get("X-Request-ID"); h != got {
+				t.Errorf("got X-Request-ID header %q; want %q", h, got)
+			}
+		})
+	}
+}
+
+func TestLogRequest(t *testing.T) {
+	var logs bytes.Buffer
+	app := &application{logger: slog.New(slog.NewJSONHandler(&logs, nil))}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// authenticate records the user further down the chain
+		setRequestUserID(r, 7)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("Created"))
+	})
+	handler := assignRequestID(app.logRequest(next))
+
+	r := httptest.NewRequest(http.MethodPost, "/snippet/create?x=1", nil)
+	r.Header.Set("X-Request-ID", "abc123")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	var line struct {
+		Msg       string `json:"msg"`
+		RequestID string `json:"request_id"`
+		Method    string `json:"method"`
+		URI       string `json:"uri"`
+		Status    int    `json:"status"`
+		Bytes     int    `json:"bytes"`
+		Duration  *int64 `json:"duration"`
+		UserID    int    `json:"user_id"`
+	}
+	if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+		t.Fatalf("decoding log line %q: %v", logs.String(), err)
+	}
+
+	if line.Msg != "request" || line.RequestID != "abc123" || line.Method != http.MethodPost || line.URI != "/snippet/create?x=1" {
+		t.Errorf("got log line %q", logs.String())
+	}
+	if line.Status != http.StatusCreated || line.Bytes != len("Created") || line.UserID != 7 {
+		t.Errorf("got status %d, %d bytes, user %d; want %d, %d bytes, user 7", line.Status, line.Bytes, line.UserID, http.StatusCreated, len("Created"))
+	}
+	if line.Duration == nil {
+		t.Error("want a duration")
+	}
+}
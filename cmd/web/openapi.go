@@ -0,0 +1,389 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"snippetbox.cnoua.org/internal/highlight"
+	"snippetbox.cnoua.org/internal/models"
+	"snippetbox.cnoua.org/internal/validator"
+)
+
+// apiOperation describes an endpoint of the JSON API for the OpenAPI
+// document. Request is a value of the type decoded from the request body,
+// nil if there's none. Response lists the fields of the response envelope
+// with a value of their type, it's nil for responses without a body.
+type apiOperation struct {
+	Method   string
+	Path     string
+	ID       string
+	Summary  string
+	Scope    string
+	Query    []apiParameter
+	Request  any
+	Status   int
+	Response envelope
+	Errors   []int
+}
+
+// apiParameter describes a query string parameter
+type apiParameter struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+// pageParameters are the query string parameters read by readPageFilter
+var pageParameters = []apiParameter{
+	{"before", "integer", "Only list snippets older than this snippet ID."},
+	{"after", "integer", "Only list snippets newer than this snippet ID."},
+	{"size", "integer", "Number of snippets per page, between 1 and 100. Defaults to 20."},
+	{"tags", "string", "Comma separated list of tags the snippets must all have."},
+}
+
+// apiOperations lists the endpoints of the JSON API, as registered in routes.go
+var apiOperations = []apiOperation{
+	{
+		Method:   http.MethodGet,
+		Path:     "/api/v1/snippets",
+		ID:       "listSnippets",
+		Summary:  "List live snippets, newest first",
+		Query:    pageParameters,
+		Status:   http.StatusOK,
+		Response: envelope{"snippets": []snippetResponse{}, "links": map[string]string{}},
+		Errors:   []int{http.StatusBadRequest},
+	},
+	{
+		Method:   http.MethodPost,
+		Path:     "/api/v1/snippets",
+		ID:       "createSnippet",
+		Summary:  "Create a snippet",
+		Scope:    models.ScopeWrite,
+		Request:  snippetRequest{},
+		Status:   http.StatusCreated,
+		Response: envelope{"snippet": snippetResponse{}},
+		Errors:   []int{http.StatusBadRequest, http.StatusUnprocessableEntity},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/api/v1/snippets/:id",
+		ID:       "getSnippet",
+		Summary:  "Get a live snippet",
+		Status:   http.StatusOK,
+		Response: envelope{"snippet": snippetResponse{}},
+		Errors:   []int{http.StatusNotFound},
+	},
+	{
+		Method:   http.MethodPut,
+		Path:     "/api/v1/snippets/:id",
+		ID:       "updateSnippet",
+		Summary:  "Replace a snippet of the authenticated user",
+		Scope:    models.ScopeWrite,
+		Request:  snippetUpdateRequest{},
+		Status:   http.StatusOK,
+		Response: envelope{"snippet": snippetResponse{}},
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity},
+	},
+	{
+		Method:  http.MethodDelete,
+		Path:    "/api/v1/snippets/:id",
+		ID:      "deleteSnippet",
+		Summary: "Delete a snippet of the authenticated user",
+		Scope:   models.ScopeDelete,
+		Status:  http.StatusNoContent,
+		Errors:  []int{http.StatusNotFound},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/api/v1/user/snippets",
+		ID:       "listUserSnippets",
+		Summary:  "List all the snippets of the authenticated user, including the expired ones",
+		Scope:    models.ScopeRead,
+		Status:   http.StatusOK,
+		Response: envelope{"snippets": []snippetResponse{}},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/v1/openapi.json",
+		ID:      "getOpenAPI",
+		Summary: "Get this OpenAPI document",
+		Status:  http.StatusOK,
+	},
+}
+
+// schema names of the types found in the API requests and responses
+var apiSchemaNames = map[reflect.Type]string{
+	reflect.TypeFor[snippetResponse]():      "Snippet",
+	reflect.TypeFor[snippetRequest]():       "SnippetInput",
+	reflect.TypeFor[snippetUpdateRequest](): "SnippetUpdate",
+	reflect.TypeFor[apiErrorBody]():         "Error",
+}
+
+// apiFieldConstraints adds the validation rules of snippetCreateForm to the
+// properties of the named schemas
+func apiFieldConstraints() map[string]map[string]map[string]any {
+	languages := []string{autoDetectLanguage}
+	for _, l := range highlight.Languages {
+		languages = append(languages, l.Name)
+	}
+
+	// the updates accept the same fields, but keep the expiry by default
+	input := func(expires map[string]any) map[string]map[string]any {
+		return map[string]map[string]any{
+			"title":        {"maxLength": maxTitleChars, "minLength": 1},
+			"content":      {"minLength": 1},
+			"content_type": {"enum": contentTypes, "default": models.ContentTypeText},
+			"language":     {"enum": languages, "default": autoDetectLanguage},
+			"expires":      expires,
+			"tags": {
+				"maxItems": maxTags,
+				"items":    map[string]any{"type": "string", "maxLength": maxTagChars, "pattern": validator.TagRX.String()},
+			},
+		}
+	}
+
+	return map[string]map[string]map[string]any{
+		"SnippetInput": input(map[string]any{
+			"enum": expiresDays, "default": 365, "description": "Number of days before the snippet expires.",
+		}),
+		"SnippetUpdate": input(map[string]any{
+			"enum": expiresDays, "description": "Number of days from now before the snippet expires. Left out, the snippet keeps its current expiry.",
+		}),
+	}
+}
+
+// openAPI builds the OpenAPI 3 document describing apiOperations
+func openAPI() map[string]any {
+	g := &schemaGenerator{schemas: map[string]any{}}
+
+	paths := map[string]map[string]any{}
+	for _, op := range apiOperations {
+		path := openAPIPath(op.Path)
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		paths[path][strings.ToLower(op.Method)] = g.operation(op)
+	}
+
+	// the Error schema is referenced by every error response
+	g.schemaOf(reflect.TypeFor[apiErrorBody]())
+
+	for name, constraints := range apiFieldConstraints() {
+		properties := g.schemas[name].(map[string]any)["properties"].(map[string]any)
+		for field, c := range constraints {
+			for key, value := range c {
+				properties[field].(map[string]any)[key] = value
+			}
+		}
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Snippetbox API",
+			"version": "1",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]any{
+				"token": map[string]any{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "Personal API token, created on the API tokens page of your account.",
+				},
+			},
+		},
+	}
+}
+
+// openAPIPath converts an httprouter path to an OpenAPI path template, e.g.
+// /snippets/:id becomes /snippets/{id}
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") {
+			segments[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// schemaGenerator derives JSON schemas from Go types. Named types are added
+// to schemas and referenced from the other schemas.
+type schemaGenerator struct {
+	schemas map[string]any
+}
+
+// operation returns the OpenAPI operation object of op
+func (g *schemaGenerator) operation(op apiOperation) map[string]any {
+	o := map[string]any{
+		"operationId": op.ID,
+		"summary":     op.Summary,
+	}
+
+	parameters := []any{}
+	for _, s := range strings.Split(op.Path, "/") {
+		if strings.HasPrefix(s, ":") {
+			parameters = append(parameters, map[string]any{
+				"name": s[1:], "in": "path", "required": true,
+				"schema": map[string]any{"type": "integer", "minimum": 1},
+			})
+		}
+	}
+	for _, p := range op.Query {
+		parameters = append(parameters, map[string]any{
+			"name": p.Name, "in": "query", "description": p.Description,
+			"schema": map[string]any{"type": p.Type},
+		})
+	}
+	if len(parameters) > 0 {
+		o["parameters"] = parameters
+	}
+
+	if op.Request != nil {
+		o["requestBody"] = map[string]any{
+			"required": true,
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": g.schemaOf(reflect.TypeOf(op.Request))},
+			},
+		}
+	}
+
+	responses := map[string]any{}
+	success := map[string]any{"description": http.StatusText(op.Status)}
+	if op.Response != nil {
+		properties := map[string]any{}
+		required := []string{}
+		for key, value := range op.Response {
+			properties[key] = g.schemaOf(reflect.TypeOf(value))
+			required = append(required, key)
+		}
+		slices.Sort(required)
+		success["content"] = map[string]any{
+			"application/json": map[string]any{
+				"schema": map[string]any{"type": "object", "properties": properties, "required": required},
+			},
+		}
+	} else if op.Status == http.StatusOK {
+		success["content"] = map[string]any{"application/json": map[string]any{"schema": map[string]any{"type": "object"}}}
+	}
+	responses[statusKey(op.Status)] = success
+
+	// every operation rejects invalid tokens, including the ones for which
+	// a token is optional
+	errorStatuses := append(slices.Clone(op.Errors), http.StatusUnauthorized)
+	if op.Scope != "" {
+		o["security"] = []any{map[string]any{"token": []string{}}}
+		o["description"] = "Requires a token with the " + op.Scope + " scope."
+		errorStatuses = append(errorStatuses, http.StatusForbidden)
+	} else {
+		// the empty requirement makes the token optional
+		o["security"] = []any{map[string]any{"token": []string{}}, map[string]any{}}
+	}
+	errorStatuses = append(errorStatuses, http.StatusInternalServerError, http.StatusServiceUnavailable)
+	for _, status := range errorStatuses {
+		responses[statusKey(status)] = map[string]any{
+			"description": http.StatusText(status),
+			"content": map[string]any{
+				"application/json": map[string]any{
+					"schema": map[string]any{
+						"type":       "object",
+						"properties": map[string]any{"error": map[string]any{"$ref": "#/components/schemas/Error"}},
+					},
+				},
+			},
+		}
+	}
+	o["responses"] = responses
+
+	return o
+}
+
+// statusKey returns the key of a status code in the responses of an operation
+func statusKey(status int) string {
+	return strconv.Itoa(status)
+}
+
+// schemaOf returns the schema of the JSON encoding of values of type t
+func (g *schemaGenerator) schemaOf(t reflect.Type) map[string]any {
+	if name, ok := apiSchemaNames[t]; ok {
+		if _, done := g.schemas[name]; !done {
+			// reserve the name first, in case the type refers to itself
+			g.schemas[name] = nil
+			g.schemas[name] = g.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+
+	if t == reflect.TypeFor[time.Time]() {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Int32:
+		return map[string]any{"type": "integer"}
+	case reflect.Float64, reflect.Float32:
+		return map[string]any{"type": "number"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schemaOf(t.Elem())}
+	case reflect.Pointer:
+		return g.schemaOf(t.Elem())
+	case reflect.Struct:
+		return g.structSchema(t)
+	}
+
+	return map[string]any{}
+}
+
+// structSchema returns the schema of a struct, following its json tags.
+// Fields without omitempty are required.
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	required := []string{}
+
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = g.schemaOf(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// openAPIHandler serves the OpenAPI document of the JSON API
+func (app *application) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	js, err := json.MarshalIndent(openAPI(), "", "\t")
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(js)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"snippetbox.cnoua.org/internal/models"
+)
+
+// apiRoutes returns the method and path of every /api/ route registered in
+// routes.go, e.g. "GET /api/v1/snippets/:id"
+func apiRoutes(t *testing.T) []string {
+	t.Helper()
+
+	f, err := parser.ParseFile(token.NewFileSet(), "cmd/web/routes.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes := []string{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) < 2 {
+			return true
+		}
+		method, ok := call.Args[0].(*ast.SelectorExpr)
+		if !ok || !strings.HasPrefix(method.Sel.Name, "Method") {
+			return true
+		}
+		lit, ok := call.Args[1].(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return true
+		}
+		path, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasPrefix(path, "/api/") {
+			routes = append(routes, strings.ToUpper(strings.TrimPrefix(method.Sel.Name, "Method"))+" "+path)
+		}
+		return true
+	})
+
+	return routes
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	routes := apiRoutes(t)
+	if len(routes) == 0 {
+		t.Fatal("found no API routes in routes.go")
+	}
+
+	doc := openAPI()
+	paths := doc["paths"].(map[string]map[string]any)
+
+	for _, route := range routes {
+		method, path, _ := strings.Cut(route, " ")
+		if _, ok := paths[openAPIPath(path)][strings.ToLower(method)]; !ok {
+			t.Errorf("route %s is missing from the OpenAPI document", route)
+		}
+	}
+
+	// and the other way round, the document shouldn't describe routes
+	// which don't exist
+	documented := 0
+	for _, operations := range paths {
+		documented += len(operations)
+	}
+	if documented != len(routes) {
+		t.Errorf("got %d documented operations; want %d", documented, len(routes))
+	}
+}
+
+// TestOpenAPIErrorStatuses sends requests failing in every way we know of to
+// each operation, and checks that the statuses they get are documented
+func TestOpenAPIErrorStatuses(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	aliceID := signup(t, app, "Alice", "alice@example.com", "pa$$word")
+	bobID := signup(t, app, "Bob", "bob@example.com", "pa$$word")
+	id := insertSnippet(t, app, aliceID, "Alice's snippet", "mine")
+
+	newToken := func(userID int, scopes ...string) string {
+		plaintext, _, err := app.tokens.Insert(t.Context(), userID, "test", scopes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return plaintext
+	}
+	readOnly := newToken(aliceID, models.ScopeRead)
+	writeOnly := newToken(aliceID, models.ScopeWrite)
+	bob := newToken(bobID, models.Scopes...)
+
+	snippet := fmt.Sprintf("/api/v1/snippets/%d", id)
+	valid := `{"title": "Edited", "content": "SELECT 1;"}`
+	invalid := `{"title": "", "content": "SELECT 1;"}`
+	malformed := `{"title": `
+
+	tests := []struct {
+		opID    string
+		method  string
+		urlPath string
+		token   string
+		body    string
+	}{
+		{"listSnippets", http.MethodGet, "/api/v1/snippets", "sbx_invalid", ""},
+		{"listSnippets", http.MethodGet, "/api/v1/snippets?size=many", "", ""},
+		{"createSnippet", http.MethodPost, "/api/v1/snippets", "", valid},
+		{"createSnippet", http.MethodPost, "/api/v1/snippets", readOnly, valid},
+		{"createSnippet", http.MethodPost, "/api/v1/snippets", writeOnly, malformed},
+		{"createSnippet", http.MethodPost, "/api/v1/snippets", writeOnly, invalid},
+		{"getSnippet", http.MethodGet, snippet, "sbx_invalid", ""},
+		{"getSnippet", http.MethodGet, "/api/v1/snippets/999", "", ""},
+		{"updateSnippet", http.MethodPut, snippet, "", valid},
+		{"updateSnippet", http.MethodPut, snippet, readOnly, valid},
+		{"updateSnippet", http.MethodPut, snippet, bob, valid},
+		{"updateSnippet", http.MethodPut, "/api/v1/snippets/999", writeOnly, valid},
+		{"updateSnippet", http.MethodPut, snippet, writeOnly, malformed},
+		{"updateSnippet", http.MethodPut, snippet, writeOnly, invalid},
+		{"deleteSnippet", http.MethodDelete, snippet, "", ""},
+		{"deleteSnippet", http.MethodDelete, snippet, readOnly, ""},
+		{"deleteSnippet", http.MethodDelete, snippet, bob, ""},
+		{"deleteSnippet", http.MethodDelete, "/api/v1/snippets/999", bob, ""},
+		{"listUserSnippets", http.MethodGet, "/api/v1/user/snippets", "", ""},
+		{"listUserSnippets", http.MethodGet, "/api/v1/user/snippets", writeOnly, ""},
+		{"getOpenAPI", http.MethodGet, "/api/v1/openapi.json", "sbx_invalid", ""},
+	}
+
+	documented := map[string][]string{}
+	for _, operations := range openAPI()["paths"].(map[string]map[string]any) {
+		for _, o := range operations {
+			o := o.(map[string]any)
+			for status := range o["responses"].(map[string]any) {
+				documented[o["operationId"].(string)] = append(documented[o["operationId"].(string)], status)
+			}
+		}
+	}
+
+	exercised := map[string]bool{}
+	for _, tt := range tests {
+		exercised[tt.opID] = true
+
+		header := http.Header{}
+		if tt.token != "" {
+			header.Set("Authorization", "Bearer "+tt.token)
+		}
+		var contentType string
+		if tt.body != "" {
+			contentType = "application/json"
+		}
+		code, _, _ := ts.do(t, tt.method, tt.urlPath, contentType, []byte(tt.body), header)
+
+		if code < 400 {
+			t.Errorf("%s %s: got status %d; want an error", tt.method, tt.urlPath, code)
+			continue
+		}
+		if !slices.Contains(documented[tt.opID], statusKey(code)) {
+			t.Errorf("%s %s: got status %d, which %s doesn't document", tt.method, tt.urlPath, code, tt.opID)
+		}
+	}
+
+	for _, op := range apiOperations {
+		if !exercised[op.ID] {
+			t.Errorf("the errors of %s aren't checked", op.ID)
+		}
+	}
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	js, err := json.Marshal(openAPI())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Components struct {
+			Schemas map[string]struct {
+				Required   []string                   `json:"required"`
+				Properties map[string]json.RawMessage `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	err = json.Unmarshal(js, &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input, ok := doc.Components.Schemas["SnippetInput"]
+	if !ok {
+		t.Fatal("missing SnippetInput schema")
+	}
+	if strings.Join(input.Required, ",") != "title,content" {
+		t.Errorf("got required %v; want [title content]", input.Required)
+	}
+	for _, want := range []string{`"maxLength":100`, `"enum":[1,7,365]`} {
+		var found bool
+		for _, p := range input.Properties {
+			found = found || strings.Contains(string(p), want)
+		}
+		if !found {
+			t.Errorf("SnippetInput properties don't contain %s", want)
+		}
+	}
+
+	for _, name := range []string{"Snippet", "Error"} {
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("missing %s schema", name)
+		}
+	}
+}
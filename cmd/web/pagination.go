@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"snippetbox.cnoua.org/internal/models"
+)
+
+// bounds for the number of snippets shown on a listing page
+const (
+	homePageSize    = 10
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var errInvalidPageParams = errors.New("invalid pagination parameters")
+
+// pagination holds what templates need to render the previous/next page
+// controls of a listing. Prev and Next are the cursors of the adjacent pages,
+// 0 if there's no such page.
+type pagination struct {
+	Path  string
+	Query url.Values
+	Size  int
+	Prev  int
+	Next  int
+}
+
+// PrevURL returns the URL of the page of newer snippets
+func (p *pagination) PrevURL() string {
+	return p.url("after", p.Prev)
+}
+
+// NextURL returns the URL of the page of older snippets
+func (p *pagination) NextURL() string {
+	return p.url("before", p.Next)
+}
+
+func (p *pagination) url(key string, cursor int) string {
+	q := url.Values{}
+	for k, v := range p.Query {
+		q[k] = v
+	}
+	q.Set(key, strconv.Itoa(cursor))
+	if p.Size != defaultPageSize {
+		q.Set("size", strconv.Itoa(p.Size))
+	}
+	return p.Path + "?" + q.Encode()
+}
+
+// readPageFilter reads the "before", "after", "size" and "tags" query
+// string parameters. The size is clamped between 1 and maxPageSize. The returned
+// filter asks for one extra snippet, which newPagination uses to tell if
+// there's another page in the same direction.
+func readPageFilter(r *http.Request) (models.PageFilter, int, error) {
+	qs := r.URL.Query()
+
+	f := models.PageFilter{}
+	size := defaultPageSize
+
+	var err error
+	if v := qs.Get("before"); v != "" {
+		f.Before, err = strconv.Atoi(v)
+		if err != nil || f.Before < 1 {
+			return f, 0, errInvalidPageParams
+		}
+	}
+	if v := qs.Get("after"); v != "" {
+		f.After, err = strconv.Atoi(v)
+		if err != nil || f.After < 1 {
+			return f, 0, errInvalidPageParams
+		}
+	}
+	if f.Before > 0 && f.After > 0 {
+		return f, 0, errInvalidPageParams
+	}
+	if v := qs.Get("size"); v != "" {
+		size, err = strconv.Atoi(v)
+		if err != nil {
+			return f, 0, errInvalidPageParams
+		}
+		size = min(max(size, 1), maxPageSize)
+	}
+
+	f.Limit = size + 1
+	f.Tags = parseTags(qs.Get("tags"))
+	return f, size, nil
+}
+
+// tagsQuery returns the query string parameters filtering a listing by the
+// given tags, to be kept in the pagination links
+func tagsQuery(tags []string) url.Values {
+	if len(tags) == 0 {
+		return nil
+	}
+	return url.Values{"tags": {strings.Join(tags, ",")}}
+}
+
+// newPagination trims the extra snippet fetched by readPageFilter off the
+// page and works out the cursors of the neighbouring pages. It returns the
+// snippets to display.
+func newPagination(path string, f models.PageFilter, size int, snippets []*models.Snippet) ([]*models.Snippet, *pagination) {
+	p := &pagination{Path: path, Size: size}
+
+	if f.After > 0 {
+		// paging towards newer snippets: we came from an older page, and
+		// the extra snippet is the newest one
+		if len(snippets) > size {
+			snippets = snippets[1:]
+			p.Prev = snippets[0].ID
+		}
+		if len(snippets) > 0 {
+			p.Next = snippets[len(snippets)-1].ID
+		}
+		return snippets, p
+	}
+
+	if len(snippets) > size {
+		snippets = snippets[:size]
+		p.Next = snippets[size-1].ID
+	}
+	if f.Before > 0 && len(snippets) > 0 {
+		p.Prev = snippets[0].ID
+	}
+
+	return snippets, p
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+
+	"snippetbox.cnoua.org/internal/models"
+)
+
+// snippetIDs builds a slice of snippets with the given ids
+func snippetIDs(ids ...int) []*models.Snippet {
+	snippets := []*models.Snippet{}
+	for _, id := range ids {
+		snippets = append(snippets, &models.Snippet{ID: id})
+	}
+	return snippets
+}
+
+func TestNewPagination(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   models.PageFilter
+		snippets []*models.Snippet
+		wantLen  int
+		wantPrev int
+		wantNext int
+	}{
+		{
+			name:     "First page with more",
+			filter:   models.PageFilter{Limit: 3},
+			snippets: snippetIDs(9, 8, 7),
+			wantLen:  2,
+			wantNext: 8,
+		},
+		{
+			name:     "Only page",
+			filter:   models.PageFilter{Limit: 3},
+			snippets: snippetIDs(9, 8),
+			wantLen:  2,
+		},
+		{
+			name:     "Older page with more",
+			filter:   models.PageFilter{Before: 8, Limit: 3},
+			snippets: snippetIDs(7, 6, 5),
+			wantLen:  2,
+			wantPrev: 7,
+			wantNext: 6,
+		},
+		{
+			name:     "Last page",
+			filter:   models.PageFilter{Before: 6, Limit: 3},
+			snippets: snippetIDs(5),
+			wantLen:  1,
+			wantPrev: 5,
+		},
+		{
+			name:     "Newer page with more",
+			filter:   models.PageFilter{After: 5, Limit: 3},
+			snippets: snippetIDs(8, 7, 6),
+			wantLen:  2,
+			wantPrev: 7,
+			wantNext: 6,
+		},
+		{
+			name:     "Newest page",
+			filter:   models.PageFilter{After: 7, Limit: 3},
+			snippets: snippetIDs(9, 8),
+			wantLen:  2,
+			wantNext: 8,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snippets, p := newPagination("/snippets", tt.filter, 2, tt.snippets)
+
+			if len(snippets) != tt.wantLen {
+				t.Errorf("got %d snippets; want %d", len(snippets), tt.wantLen)
+			}
+			if p.Prev != tt.wantPrev {
+				t.Errorf("got prev %d; want %d", p.Prev, tt.wantPrev)
+			}
+			if p.Next != tt.wantNext {
+				t.Errorf("got next %d; want %d", p.Next, tt.wantNext)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"snippetbox.cnoua.org/internal/models"
+)
+
+// purger deletes the snippets which expired more than retention ago, every
+// interval, in batches of batchSize snippets. Expired snippets are kept for a
+// while since their authors can still see them on their account page.
+type purger struct {
+	snippets  models.SnippetStore
+	logger    *slog.Logger
+	interval  time.Duration
+	retention time.Duration
+	batchSize int
+
+	// running is set while the goroutine of the purger runs, and heartbeat
+	// holds the time, in Unix nanoseconds, it last made progress: when it
+	// started waiting for the next purge or deleted a batch. The health
+	// endpoints read them.
+	running   atomic.Bool
+	heartbeat atomic.Int64
+}
+
+// start runs the purger in a background goroutine until ctx is cancelled.
+// The returned function waits for the goroutine to return, which happens
+// once the batch being deleted, if any, is done.
+func (p *purger) start(ctx context.Context) (wait func()) {
+	var wg sync.WaitGroup
+
+	p.beat()
+	p.running.Store(true)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer p.running.Store(false)
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.purge(ctx)
+				p.beat()
+			}
+		}
+	}()
+
+	return wg.Wait
+}
+
+// purge deletes the expired snippets batch after batch, until there are none
+// left or ctx is cancelled
+func (p *purger) purge(ctx context.Context) {
+	before := models.Now().Add(-p.retention)
+
+	// a batch being deleted isn't interrupted by the cancellation of ctx,
+	// the loop stops after it
+	batchCtx := context.WithoutCancel(ctx)
+
+	total := 0
+	for ctx.Err() == nil {
+		n, err := p.snippets.PurgeExpired(batchCtx, before, p.batchSize)
+		if err != nil {
+			p.logger.Error("purging expired snippets", "error", err)
+			break
+		}
+		total += n
+		p.beat()
+		if n < p.batchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		p.logger.Info("Purged expired snippets", "count", total, "expired_before", before.Format(time.RFC3339))
+	}
+}
+
+// beat records that the purger made progress
+func (p *purger) beat() {
+	p.heartbeat.Store(time.Now().UnixNano())
+}
+
+// alive reports whether the goroutine of the purger is running. A long purge
+// doesn't make it fail: the first ones on a large table can take a while.
+func (p *purger) alive() error {
+	if !p.running.Load() {
+		return errors.New("purger stopped")
+	}
+	return nil
+}
+
+// stalled reports whether the purger made no progress for two intervals,
+// a batch taking longer than an interval, which means the database can't
+// keep up
+func (p *purger) stalled() error {
+	if since := time.Since(time.Unix(0, p.heartbeat.Load())); since > 2*p.interval {
+		return fmt.Errorf("purger made no progress for %s", since.Round(time.Millisecond))
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"snippetbox.cnoua.org/internal/models"
+	"snippetbox.cnoua.org/internal/models/memory"
+)
+
+func TestPurger(t *testing.T) {
+	snippets := memory.New().Snippets()
+	for _, expires := range []int{-3, -2, 7} {
+		_, err := snippets.Insert(t.Context(), &models.Snippet{Title: "Hello", Content: "hello", ContentType: models.ContentTypeText}, expires)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var logs bytes.Buffer
+	p := &purger{
+		snippets:  snippets,
+		logger:    slog.New(slog.NewTextHandler(&logs, nil)),
+		interval:  time.Millisecond,
+		retention: 24 * time.Hour,
+		batchSize: 1,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wait := p.start(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		page, err := snippets.ByUser(t.Context(), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d snippets left; want 1", len(page))
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	wait()
+
+	if !strings.Contains(logs.String(), `msg="Purged expired snippets" count=2 `) {
+		t.Errorf("got logs %q", logs.String())
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"snippetbox.cnoua.org/internal/models"
+)
+
+// refreshOverlap is how far back each refresh of the search index looks
+// before the previous one. Revisions are timestamped before their transaction
+// commits and to the second, so a snippet changed by another instance right
+// as a refresh runs is only visible to the next one.
+const refreshOverlap = time.Minute
+
+// indexRefresher adds the snippets created or changed by the other instances
+// of the application to the search index of snippets, every interval. since
+// is the time of the last successful refresh.
+type indexRefresher struct {
+	snippets *models.SnippetModel
+	logger   *slog.Logger
+	interval time.Duration
+	since    time.Time
+}
+
+// start runs the refresher in a background goroutine until ctx is cancelled.
+// The returned function waits for the goroutine to return.
+func (r *indexRefresher) start(ctx context.Context) (wait func()) {
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.refresh(ctx)
+			}
+		}
+	}()
+
+	return wg.Wait
+}
+
+// refresh adds the snippets changed since the last successful refresh to the
+// search index. A failed refresh is retried at the next tick from the same
+// time.
+func (r *indexRefresher) refresh(ctx context.Context) {
+	now := models.Now()
+
+	n, err := r.snippets.RefreshIndex(ctx, r.since.Add(-refreshOverlap))
+	if err != nil {
+		if ctx.Err() == nil {
+			r.logger.Error("refreshing the search index", "error", err)
+		}
+		return
+	}
+	r.since = now
+
+	if n > 0 {
+		r.logger.Debug("Refreshed the search index", "count", n)
+	}
+}
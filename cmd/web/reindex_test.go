@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"snippetbox.cnoua.org/internal/config"
+	"snippetbox.cnoua.org/internal/models"
+	"snippetbox.cnoua.org/internal/search"
+)
+
+// TestIndexRefresher runs two instances on the same SQLite database, and
+// checks that a snippet created through one is found by the other
+func TestIndexRefresher(t *testing.T) {
+	cfg := config.Default()
+	cfg.DB.Backend = "sqlite"
+	cfg.BcryptCost = bcrypt.MinCost
+	cfg.DB.DSN = "file:" + filepath.Join(t.TempDir(), "snippetbox.db") + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	instances := make([]*backend, 2)
+	for i := range instances {
+		b, err := openBackend(cfg, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { b.close() })
+		instances[i] = b
+	}
+	writer, reader := instances[0], instances[1]
+
+	r := &indexRefresher{
+		snippets: reader.index,
+		logger:   logger,
+		interval: time.Millisecond,
+		since:    reader.indexed,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	wait := r.start(ctx)
+	defer func() {
+		cancel()
+		wait()
+	}()
+
+	err := writer.users.Insert(t.Context(), "Alice", "alice@example.com", "pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, err := writer.users.Authenticate(t.Context(), "alice@example.com", "pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := writer.snippets.Insert(t.Context(), &models.Snippet{Title: "Hello", Content: "hello world", ContentType: models.ContentTypeText, UserID: userID}, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		found, err := reader.snippets.Search(t.Context(), search.Parse("hello"), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(found) == 1 && found[0].ID == id {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got search results %+v; want snippet %d", found, id)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
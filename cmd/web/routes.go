@@ -5,6 +5,7 @@ import (
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/alice"
+	"snippetbox.cnoua.org/internal/models"
 )
 
 // it returns a http.Handler instead of *http.ServeMux
@@ -12,42 +13,101 @@ func (app *application) routes() http.Handler {
 	// initialize the router
 	router := httprouter.New()
 
-	// custom handler for 404 responses
-	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		app.notFound(w)
-	})
+	// handle registers a route, recording its pattern for the metrics
+	handle := func(method, pattern string, handler http.Handler) {
+		router.Handler(method, pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			setRequestRoute(r, pattern)
+			handler.ServeHTTP(w, r)
+		}))
+	}
+
+	// custom handlers for 404 and 405 responses
+	router.NotFound = http.HandlerFunc(app.notFound)
+	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowed)
 	// route for the static files
-	fileServer := http.FileServer(http.Dir("./ui/static/"))
-	router.Handler(http.MethodGet, "/static/*filepath", http.StripPrefix("/static", fileServer))
+	fileServer := http.FileServer(http.Dir(app.staticDir))
+	handle(http.MethodGet, "/static/*filepath", http.StripPrefix("/static", fileServer))
 
 	// add a GET /ping route
-	router.HandlerFunc(http.MethodGet, "/ping", ping)
+	handle(http.MethodGet, "/ping", http.HandlerFunc(ping))
+	// liveness and readiness probes for the load balancer, which leave out
+	// the errors of the checks: they're for the admin listener
+	handle(http.MethodGet, "/healthz", app.healthz(false))
+	handle(http.MethodGet, "/readyz", app.readyz(false))
+
+	// raw and download routes only send the snippet content, they don't need
+	// sessions or CSRF protection
+	handle(http.MethodGet, "/snippet/raw/:id", http.HandlerFunc(app.snippetRaw))
+	handle(http.MethodGet, "/snippet/download/:id", http.HandlerFunc(app.snippetDownload))
 
 	// middleware chain containing the middleware specific to dynamic
 	// application routes. Unprotected routes use it.
-	dynamic := alice.New(app.sessionManager.LoadAndSave, noSurf, app.authenticate)
+	dynamic := alice.New(app.sessionManager.LoadAndSave, app.noSurf, app.authenticate)
 
 	// update routes to use the new dynamic middleware chain followed by the
-	// appropriate handler fn. Note that because the alice ThenFunc() returns
-	// a http.Handler (rather than a http.HandlerFunc) we also need to switch
-	// to registering the route using the router.Handler() method.
-	router.Handler(http.MethodGet, "/", dynamic.ThenFunc(app.home))
-	router.Handler(http.MethodGet, "/snippet/view/:id", dynamic.ThenFunc(app.snippetView))
-	router.Handler(http.MethodGet, "/user/signup", dynamic.ThenFunc(app.userSignup))
-	router.Handler(http.MethodPost, "/user/signup", dynamic.ThenFunc(app.userSignupPost))
-	router.Handler(http.MethodGet, "/user/login", dynamic.ThenFunc(app.userLogin))
-	router.Handler(http.MethodPost, "/user/login", dynamic.ThenFunc(app.userLoginPost))
+	// appropriate handler fn. Note that alice ThenFunc() returns a
+	// http.Handler, which is what handle() takes.
+	handle(http.MethodGet, "/", dynamic.ThenFunc(app.home))
+	handle(http.MethodGet, "/snippets", dynamic.ThenFunc(app.snippetList))
+	handle(http.MethodGet, "/search", dynamic.ThenFunc(app.snippetSearch))
+	handle(http.MethodGet, "/tag/:name", dynamic.ThenFunc(app.tagView))
+	handle(http.MethodGet, "/snippet/view/:id", dynamic.ThenFunc(app.snippetView))
+	handle(http.MethodGet, "/snippet/view/:id/history", dynamic.ThenFunc(app.snippetHistory))
+	handle(http.MethodGet, "/snippet/view/:id/diff", dynamic.ThenFunc(app.snippetDiff))
+	handle(http.MethodGet, "/user/signup", dynamic.ThenFunc(app.userSignup))
+	handle(http.MethodPost, "/user/signup", dynamic.ThenFunc(app.userSignupPost))
+	handle(http.MethodGet, "/user/login", dynamic.ThenFunc(app.userLogin))
+	handle(http.MethodPost, "/user/login", dynamic.ThenFunc(app.userLoginPost))
 
 	// protected application routes using a middleware chain which includes
 	// the requireAuthentication middleare.
 	protected := dynamic.Append(app.requireAuthentication)
 
-	router.Handler(http.MethodGet, "/snippet/create", protected.ThenFunc(app.snippetCreate))
-	router.Handler(http.MethodPost, "/snippet/create", protected.ThenFunc(app.snippetCreatePost))
-	router.Handler(http.MethodPost, "/user/logout", protected.ThenFunc(app.userLogoutPost))
+	handle(http.MethodGet, "/snippet/create", protected.ThenFunc(app.snippetCreate))
+	handle(http.MethodPost, "/snippet/create", protected.ThenFunc(app.snippetCreatePost))
+	handle(http.MethodGet, "/snippet/edit/:id", protected.ThenFunc(app.snippetEdit))
+	handle(http.MethodPost, "/snippet/edit/:id", protected.ThenFunc(app.snippetEditPost))
+	handle(http.MethodPost, "/snippet/delete/:id", protected.ThenFunc(app.snippetDeletePost))
+	handle(http.MethodPost, "/snippet/view/:id/history/prune", protected.ThenFunc(app.snippetHistoryPrunePost))
+	handle(http.MethodGet, "/user/snippets", protected.ThenFunc(app.userSnippets))
+	handle(http.MethodGet, "/account/tokens", protected.ThenFunc(app.accountTokens))
+	handle(http.MethodPost, "/account/tokens", protected.ThenFunc(app.accountTokensPost))
+	handle(http.MethodPost, "/account/tokens/revoke/:id", protected.ThenFunc(app.accountTokenRevokePost))
+	handle(http.MethodPost, "/user/logout", protected.ThenFunc(app.userLogoutPost))
+
+	// the JSON API doesn't use sessions, so it needs no CSRF protection:
+	// clients send a personal API token with every request instead. Each
+	// protected route requires its own token scope.
+	api := alice.New(app.authenticateAPI)
+	apiRead := api.Append(app.requireScope(models.ScopeRead))
+	apiWrite := api.Append(app.requireScope(models.ScopeWrite))
+	apiDelete := api.Append(app.requireScope(models.ScopeDelete))
+
+	handle(http.MethodGet, "/api/v1/snippets", api.ThenFunc(app.apiSnippetList))
+	handle(http.MethodPost, "/api/v1/snippets", apiWrite.ThenFunc(app.apiSnippetCreate))
+	handle(http.MethodGet, "/api/v1/snippets/:id", api.ThenFunc(app.apiSnippetView))
+	handle(http.MethodPut, "/api/v1/snippets/:id", apiWrite.ThenFunc(app.apiSnippetUpdate))
+	handle(http.MethodDelete, "/api/v1/snippets/:id", apiDelete.ThenFunc(app.apiSnippetDelete))
+	handle(http.MethodGet, "/api/v1/user/snippets", apiRead.ThenFunc(app.apiUserSnippets))
+	handle(http.MethodGet, "/api/v1/openapi.json", api.ThenFunc(app.openAPIHandler))
 
-	// create a middleware chain used for every request
-	standard := alice.New(app.recoverPanic, app.logRequest, secureHeaders)
+	// create a middleware chain used for every request. The request ID comes
+	// first so every log line can carry it, and the access log, the metrics
+	// and the trace wrap recoverPanic so requests ending in a panic are
+	// counted too.
+	standard := alice.New(assignRequestID, app.logRequest, app.instrument, app.traceRequest, app.recoverPanic, secureHeaders)
 
 	return standard.Then(router)
 }
+
+// adminRoutes returns the handler of the admin listener, which isn't exposed
+// to the public. It serves the health endpoints too, with the errors of the
+// failed checks, and keeps running while the public server shuts down.
+func (app *application) adminRoutes() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", app.metrics.handler(app.logger))
+	mux.Handle("GET /healthz", app.healthz(true))
+	mux.Handle("GET /readyz", app.readyz(true))
+
+	return mux
+}
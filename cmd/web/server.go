@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// serve runs the server with listen, ListenAndServeTLS() or alike, until ctx
+// is cancelled. The server is then shut down gracefully: it stops accepting
+// connections and waits up to timeout for the requests in flight to finish,
+// before closing the remaining connections.
+func serve(ctx context.Context, srv *http.Server, listen func() error, timeout time.Duration, logger *slog.Logger) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- listen()
+	}()
+
+	select {
+	case err := <-errs:
+		// the server failed to start, listen never returns nil
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Info("Shutting down server, waiting for requests in flight", "timeout", timeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		srv.Close()
+		return fmt.Errorf("shutting down server: %w", err)
+	}
+
+	// listen returns ErrServerClosed as soon as Shutdown() is called
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	logger.Info("Stopped server")
+	return nil
+}
+
+// startAdmin serves handler over plain HTTP on addr, in a background
+// goroutine. The address is listened on right away so that a busy one makes
+// the application fail to start. The returned function closes the server.
+func startAdmin(addr string, handler http.Handler, logger *slog.Logger) (stop func(), err error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("admin listener: %w", err)
+	}
+
+	srv := &http.Server{
+		Handler:           handler,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelError),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("admin server stopped", "error", err)
+		}
+	}()
+
+	logger.Info("Starting admin server", "addr", ln.Addr().String())
+	return func() { srv.Close() }, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestServeShutdown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("OK"))
+	})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, srv, func() error { return srv.Serve(ln) }, 5*time.Second, slog.New(slog.DiscardHandler))
+	}()
+
+	type result struct {
+		code int
+		err  error
+	}
+	responses := make(chan result, 1)
+	go func() {
+		rs, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			responses <- result{err: err}
+			return
+		}
+		rs.Body.Close()
+		responses <- result{code: rs.StatusCode}
+	}()
+
+	// shut down while the request is in flight, it must still complete
+	<-started
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	rs := <-responses
+	if rs.err != nil || rs.code != http.StatusOK {
+		t.Errorf("got %d, %v for the request in flight; want %d", rs.code, rs.err, http.StatusOK)
+	}
+	if err = <-served; err != nil {
+		t.Errorf("got error %v; want a clean shutdown", err)
+	}
+}
+
+func TestServeShutdownTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, srv, func() error { return srv.Serve(ln) }, 10*time.Millisecond, slog.New(slog.DiscardHandler))
+	}()
+
+	go func() {
+		rs, err := http.Get("http://" + ln.Addr().String())
+		if err == nil {
+			rs.Body.Close()
+		}
+	}()
+
+	<-started
+	cancel()
+
+	if err = <-served; err == nil {
+		t.Error("got no error; want the shutdown to time out")
+	}
+}
@@ -3,21 +3,54 @@ package main
 import (
 	"html/template"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
+	"snippetbox.cnoua.org/internal/diff"
+	"snippetbox.cnoua.org/internal/highlight"
+	"snippetbox.cnoua.org/internal/markdown"
 	"snippetbox.cnoua.org/internal/models"
+	"snippetbox.cnoua.org/internal/search"
 )
 
 // define a templateData type to act as the holding structure for
 // any dynamic data passed to our html templates.
 type templateData struct {
-	CurrentYear     int
-	Snippet         *models.Snippet
-	Snippets        []*models.Snippet
-	Form            any
-	Flash           string
-	IsAuthenticated bool
-	CSRFToken       string
+	CurrentYear         int
+	Snippet             *models.Snippet
+	Snippets            []*models.Snippet
+	ExpiredSnippets     []*models.Snippet
+	Revisions           []*models.Revision
+	Diff                *revisionDiff
+	Pagination          *pagination
+	Search              *searchData
+	Tags                []string
+	Tokens              []*models.Token
+	NewToken            string
+	Form                any
+	Flash               string
+	IsAuthenticated     bool
+	AuthenticatedUserID int
+	CSRFToken           string
+	Error               *errorData
+}
+
+// revisionDiff holds the changes between two revisions of a snippet
+type revisionDiff struct {
+	From  *models.Revision
+	To    *models.Revision
+	Hunks []diff.Hunk
+}
+
+// maximum number of results shown on the search page
+const maxSearchResults = 50
+
+// searchData holds the query of the search page, both as typed by the user
+// and parsed
+type searchData struct {
+	Q     string
+	Query search.Query
 }
 
 // fn returns a formatted string of time.Time object
@@ -25,17 +58,99 @@ func humanDate(t time.Time) string {
 	return t.Format("02 Jan 2006 at 15:04")
 }
 
+// add returns the sum of two integers, e.g. to get the next item of a list
+func add(a, b int) int {
+	return a + b
+}
+
+// sub returns the difference of two integers, e.g. to get the index of the
+// last item of a list
+func sub(a, b int) int {
+	return a - b
+}
+
+// markMatches escapes text and wraps the parts of it matching the search
+// query in <mark> elements
+func markMatches(text string, q search.Query) template.HTML {
+	var sb strings.Builder
+	last := 0
+	for _, span := range q.Matches(text) {
+		sb.WriteString(template.HTMLEscapeString(text[last:span.Start]))
+		sb.WriteString("<mark>")
+		sb.WriteString(template.HTMLEscapeString(text[span.Start:span.End]))
+		sb.WriteString("</mark>")
+		last = span.End
+	}
+	sb.WriteString(template.HTMLEscapeString(text[last:]))
+	return template.HTML(sb.String())
+}
+
+// excerpt returns a short part of text around the first match of the query
+func excerpt(text string, q search.Query) string {
+	return q.Excerpt(text, 160)
+}
+
+// highlightCode renders code as HTML with syntax highlighting and line numbers.
+// The markup only uses classes styled by main.css, as inline styles are
+// blocked by our Content-Security-Policy.
+func highlightCode(code, language string) (template.HTML, error) {
+	html, err := highlight.HTML(code, language)
+	if err != nil {
+		return "", err
+	}
+	// the highlighter escapes the code, so it's safe to use as is
+	return template.HTML(html), nil
+}
+
+// renderMarkdown renders markdown content as HTML. The output goes through an
+// allow-list sanitizer, so it can't inject scripts or styles into the page.
+func renderMarkdown(source string) (template.HTML, error) {
+	html, err := markdown.Render(source)
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(html), nil
+}
+
+// scopes returns the scopes API tokens can be given
+func scopes() []string {
+	return models.Scopes
+}
+
+// contains returns true if list contains s
+func contains(list []string, s string) bool {
+	return slices.Contains(list, s)
+}
+
+// languages returns the languages snippets can be highlighted as
+func languages() []highlight.Language {
+	return highlight.Languages
+}
+
 // initialize a template.FuncMap object & store it in a global variable. it acts as a
 // lookup table for our custom template functions
 var functions = template.FuncMap{
-	"humanDate": humanDate,
+	"humanDate":   humanDate,
+	"add":         add,
+	"sub":         sub,
+	"markMatches": markMatches,
+	"excerpt":     excerpt,
+	"join":        strings.Join,
+	"highlight":   highlightCode,
+	"markdown":    renderMarkdown,
+	"scopes":      scopes,
+	"contains":    contains,
+	"languages":   languages,
+	"language":    highlight.Label,
 }
 
-func newTemplateCache() (map[string]*template.Template, error) {
+// newTemplateCache parses the templates of every page, found in the given
+// directory
+func newTemplateCache(dir string) (map[string]*template.Template, error) {
 	// initialize a new map to act as the cache
 	cache := map[string]*template.Template{}
 	// get a slice of all filepaths for 'page' templates
-	pages, err := filepath.Glob("./ui/html/pages/*.tmpl")
+	pages, err := filepath.Glob(filepath.Join(dir, "pages", "*.tmpl"))
 	if err != nil {
 		return nil, err
 	}
@@ -47,13 +162,13 @@ func newTemplateCache() (map[string]*template.Template, error) {
 		// use template.New() to create an empty template set, use the Funcs() method
 		// to register the template.FuncMap, and then
 		// parse the base template into a template set
-		ts, err := template.New(name).Funcs(functions).ParseFiles("./ui/html/base.tmpl")
+		ts, err := template.New(name).Funcs(functions).ParseFiles(filepath.Join(dir, "base.tmpl"))
 		if err != nil {
 			return nil, err
 		}
 
 		// call ParseGlob() on template set to add any partials
-		ts, err = ts.ParseGlob("./ui/html/partials/*.tmpl")
+		ts, err = ts.ParseGlob(filepath.Join(dir, "partials", "*.tmpl"))
 		if err != nil {
 			return nil, err
 		}
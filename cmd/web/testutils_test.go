@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/go-playground/form/v4"
+	"golang.org/x/crypto/bcrypt"
+	"snippetbox.cnoua.org/internal/models/memory"
+)
+
+func TestMain(m *testing.M) {
+	// the templates and static files are read relative to the root of the
+	// repository, like when running the application
+	if err := os.Chdir("../.."); err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newTestApplication returns an application backed by the in-memory store,
+// with the logger discarding its output
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+
+	templateCache, err := newTemplateCache("./ui/html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := memory.New()
+	// the cheapest password hashes keep the tests fast
+	users := db.Users()
+	users.BcryptCost = bcrypt.MinCost
+
+	// scs uses an in-memory session store by default
+	sessionManager := scs.New()
+	sessionManager.Lifetime = 12 * time.Hour
+	sessionManager.Cookie.Secure = true
+
+	return &application{
+		logger:         slog.New(slog.DiscardHandler),
+		metrics:        newMetrics(),
+		health:         &health{sessions: sessionManager.Store},
+		snippets:       db.Snippets(),
+		revisions:      db.Revisions(),
+		users:          users,
+		tokens:         db.Tokens(),
+		templateCache:  templateCache,
+		staticDir:      "./ui/static",
+		formDecoder:    form.NewDecoder(),
+		sessionManager: sessionManager,
+	}
+}
+
+// testServer embeds httptest.Server, with a client keeping cookies and not
+// following redirects
+type testServer struct {
+	*httptest.Server
+}
+
+func newTestServer(t *testing.T, h http.Handler) *testServer {
+	t.Helper()
+
+	ts := httptest.NewTLSServer(h)
+	t.Cleanup(ts.Close)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Client().Jar = jar
+
+	ts.Client().CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &testServer{ts}
+}
+
+// do sends a request to the test server and returns the response status
+// code, headers and body
+func (ts *testServer) do(t *testing.T, method, urlPath, contentType string, body []byte, header http.Header) (int, http.Header, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, ts.URL+urlPath, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nosurf rejects unsafe requests over HTTPS coming from another origin,
+	// like a browser would send them
+	req.Header.Set("Origin", ts.URL)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	b, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, rs.Header, string(bytes.TrimSpace(b))
+}
+
+func (ts *testServer) get(t *testing.T, urlPath string) (int, http.Header, string) {
+	t.Helper()
+	return ts.do(t, http.MethodGet, urlPath, "", nil, nil)
+}
+
+func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (int, http.Header, string) {
+	t.Helper()
+	return ts.do(t, http.MethodPost, urlPath, "application/x-www-form-urlencoded", []byte(form.Encode()), nil)
+}
+
+var csrfTokenRX = regexp.MustCompile(`name=["']csrf_token["'] value=["']([^"']+)["']`)
+
+// extractCSRFToken returns the CSRF token of the first form in body
+func extractCSRFToken(t *testing.T, body string) string {
+	t.Helper()
+
+	matches := csrfTokenRX.FindStringSubmatch(body)
+	if len(matches) < 2 {
+		t.Fatal("no csrf token found in body")
+	}
+
+	return html.UnescapeString(matches[1])
+}
+
+// signup creates a user and returns its ID
+func signup(t *testing.T, app *application, name, email, password string) int {
+	t.Helper()
+
+	if err := app.users.Insert(t.Context(), name, email, password); err != nil {
+		t.Fatal(err)
+	}
+	id, err := app.users.Authenticate(t.Context(), email, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// login logs the test server's client in, and returns a CSRF token to use in
+// the following requests
+func (ts *testServer) login(t *testing.T, email, password string) string {
+	t.Helper()
+
+	_, _, body := ts.get(t, "/user/login")
+	form := url.Values{
+		"email":      {email},
+		"password":   {password},
+		"csrf_token": {extractCSRFToken(t, body)},
+	}
+
+	code, _, _ := ts.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("got status %d logging in; want %d", code, http.StatusSeeOther)
+	}
+
+	_, _, body = ts.get(t, "/snippet/create")
+	return extractCSRFToken(t, body)
+}
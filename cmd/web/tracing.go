@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"snippetbox.cnoua.org/internal/config"
+)
+
+// tracerName names the tracer of the spans of the requests and of the
+// templates
+const tracerName = "snippetbox.cnoua.org/cmd/web"
+
+// tracer returns the tracer of the spans of the requests and of the
+// templates, from the tracer provider of the application or else the global
+// one, set up by setupTracing. The global provider is looked up every time
+// as it can be set after the application is created.
+func (app *application) tracer() trace.Tracer {
+	tp := app.tracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+// setupTracing sets the global tracer provider up to export the spans as
+// configured, and the propagator reading the W3C trace context of incoming
+// requests. The returned function flushes the spans left and stops the
+// exporter.
+func setupTracing(cfg config.Tracing) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	closeFile := func() error { return nil }
+
+	switch cfg.Exporter {
+	case "none":
+		// the default global provider creates spans which record nothing
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(context.Background(), opts...)
+	case "file":
+		f, ferr := os.OpenFile(cfg.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if ferr != nil {
+			return nil, ferr
+		}
+		closeFile = f.Close
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	default:
+		err = errors.New("unknown trace exporter " + cfg.Exporter)
+	}
+	if err != nil {
+		closeFile()
+		return nil, err
+	}
+
+	// the default resource describes the process and the host, and reads
+	// the OTEL_RESOURCE_ATTRIBUTES variable
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", "snippetbox")))
+	if err != nil {
+		closeFile()
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		return errors.Join(provider.Shutdown(ctx), closeFile())
+	}, nil
+}
+
+// traceRequest starts the span of a request, continuing the trace of the
+// client if it sent one. The span is named after the route once the router
+// matched it, and carries the ID of the authenticated user if any. Like
+// logRequest, it must come after assignRequestID in the chain.
+func (app *application) traceRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		propagator := app.propagator
+		if propagator == nil {
+			propagator = otel.GetTextMapPropagator()
+		}
+		ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := app.tracer().Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("request.id", requestID(r)),
+			),
+		)
+		defer span.End()
+
+		rw := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rw, r.WithContext(ctx))
+
+		if rw.status == 0 {
+			rw.status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", rw.status))
+		if rw.status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(rw.status))
+		}
+
+		if info, ok := r.Context().Value(requestInfoContextKey).(*requestInfo); ok {
+			if info.route != "" {
+				span.SetName(r.Method + " " + info.route)
+				span.SetAttributes(attribute.String("http.route", info.route))
+			}
+			if info.userID != 0 {
+				span.SetAttributes(attribute.Int("enduser.id", info.userID))
+			}
+		}
+	})
+}
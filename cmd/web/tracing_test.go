@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceRequest(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+
+	app := newTestApplication(t)
+	app.tracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	app.propagator = propagation.TraceContext{}
+	ts := newTestServer(t, app.routes())
+
+	userID := signup(t, app, "Alice", "alice@example.com", "pa$$word")
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	// the client's trace is continued
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	code, _, _ := ts.do(t, http.MethodGet, "/snippet/create", "", nil, http.Header{
+		"Traceparent": {"00-" + traceID + "-00f067aa0ba902b7-01"},
+	})
+	if code != http.StatusOK {
+		t.Fatalf("got status %d; want %d", code, http.StatusOK)
+	}
+
+	var request, render sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID().String() != traceID {
+			continue
+		}
+		switch span.Name() {
+		case "GET /snippet/create":
+			request = span
+		case "render create.tmpl":
+			render = span
+		}
+	}
+	if request == nil || render == nil {
+		t.Fatalf("got no request or render span in the client's trace")
+	}
+
+	if request.SpanKind() != trace.SpanKindServer {
+		t.Errorf("got span kind %v; want %v", request.SpanKind(), trace.SpanKindServer)
+	}
+	attrs := map[string]string{}
+	for _, attr := range request.Attributes() {
+		attrs[string(attr.Key)] = attr.Value.Emit()
+	}
+	for key, want := range map[string]string{
+		"http.route":                "/snippet/create",
+		"http.response.status_code": "200",
+		"enduser.id":                strconv.Itoa(userID),
+	} {
+		if attrs[key] != want {
+			t.Errorf("got %s %q; want %q", key, attrs[key], want)
+		}
+	}
+
+	if render.Parent().SpanID() != request.SpanContext().SpanID() {
+		t.Error("want the render span to be a child of the request span")
+	}
+}
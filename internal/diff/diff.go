@@ -0,0 +1,223 @@
+// Package diff computes line-by-line differences between two texts and
+// groups them into hunks suitable for a unified diff view.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Op is the kind of change a line represents
+type Op int
+
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+// Line is a single line of a diff. OldLine and NewLine are the 1-based line
+// numbers in the old and new texts, 0 if the line doesn't appear in that text.
+type Line struct {
+	Op      Op
+	Text    string
+	OldLine int
+	NewLine int
+}
+
+// Prefix returns the marker used for the line in unified diff output
+func (l Line) Prefix() string {
+	switch l.Op {
+	case Insert:
+		return "+"
+	case Delete:
+		return "-"
+	default:
+		return " "
+	}
+}
+
+// Hunk is a group of changed lines surrounded by some unchanged context
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Lines    []Line
+}
+
+// Header returns the hunk range information in unified diff format,
+// e.g. "@@ -1,4 +1,5 @@"
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+}
+
+// Lines returns the edit script turning a into b, one entry per line. It uses
+// Myers' O(ND) algorithm so that the common case of a few changes in a large
+// text stays cheap.
+func Lines(a, b string) []Line {
+	x, y := split(a), split(b)
+	lines := myers(x, y)
+
+	// number the lines
+	oldLine, newLine := 0, 0
+	for i := range lines {
+		switch lines[i].Op {
+		case Equal:
+			oldLine++
+			newLine++
+			lines[i].OldLine, lines[i].NewLine = oldLine, newLine
+		case Delete:
+			oldLine++
+			lines[i].OldLine = oldLine
+		case Insert:
+			newLine++
+			lines[i].NewLine = newLine
+		}
+	}
+
+	return lines
+}
+
+// Hunks groups the changes of a diff into hunks, keeping up to context
+// unchanged lines around each change. Hunks whose context overlaps are merged.
+// It returns nil if there are no changes.
+func Hunks(lines []Line, context int) []Hunk {
+	var hunks []Hunk
+
+	for i := 0; i < len(lines); {
+		if lines[i].Op == Equal {
+			i++
+			continue
+		}
+
+		// found a change, start a hunk including the preceding context
+		start := max(i-context, 0)
+		end := i
+		for end < len(lines) {
+			if lines[end].Op != Equal {
+				end++
+				continue
+			}
+			// count the unchanged lines that follow, if another change comes
+			// before we run out of context the hunks are merged
+			next := end
+			for next < len(lines) && lines[next].Op == Equal {
+				next++
+			}
+			if next < len(lines) && next-end <= 2*context {
+				end = next
+				continue
+			}
+			end = min(end+context, len(lines))
+			break
+		}
+
+		hunks = append(hunks, newHunk(lines[start:end]))
+		i = end
+	}
+
+	return hunks
+}
+
+func newHunk(lines []Line) Hunk {
+	h := Hunk{Lines: lines}
+	for _, l := range lines {
+		if l.Op != Insert {
+			if h.OldStart == 0 {
+				h.OldStart = l.OldLine
+			}
+			h.OldLines++
+		}
+		if l.Op != Delete {
+			if h.NewStart == 0 {
+				h.NewStart = l.NewLine
+			}
+			h.NewLines++
+		}
+	}
+	return h
+}
+
+// split breaks a text into lines, ignoring the difference between CRLF and
+// LF line endings and a trailing newline
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.TrimSuffix(s, "\n")
+	return strings.Split(s, "\n")
+}
+
+func myers(a, b []string) []Line {
+	n, m := len(a), len(b)
+	offset := n + m
+	v := make([]int, 2*offset+2)
+
+	// trace holds a copy of v as it was at the start of each round d, which
+	// is what we need to walk the edit path backwards
+	var trace [][]int
+
+search:
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// backtrack from the end of both texts, the lines are collected in
+	// reverse order
+	var lines []Line
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			lines = append(lines, Line{Op: Equal, Text: a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			lines = append(lines, Line{Op: Insert, Text: b[y-1]})
+		} else {
+			lines = append(lines, Line{Op: Delete, Text: a[x-1]})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		lines = append(lines, Line{Op: Equal, Text: a[x-1]})
+		x--
+		y--
+	}
+
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+
+	return lines
+}
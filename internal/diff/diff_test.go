@@ -0,0 +1,90 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+// unified renders lines the way a unified diff would, one line per entry
+func unified(lines []Line) string {
+	var sb strings.Builder
+	for _, l := range lines {
+		sb.WriteString(l.Prefix() + l.Text + "\n")
+	}
+	return sb.String()
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want string
+	}{
+		{
+			name: "Identical",
+			a:    "a\nb\n",
+			b:    "a\nb",
+			want: " a\n b\n",
+		},
+		{
+			name: "Empty old",
+			a:    "",
+			b:    "a\nb",
+			want: "+a\n+b\n",
+		},
+		{
+			name: "Empty new",
+			a:    "a\nb",
+			b:    "",
+			want: "-a\n-b\n",
+		},
+		{
+			name: "Changed line",
+			a:    "a\nb\nc",
+			b:    "a\nx\nc",
+			want: " a\n-b\n+x\n c\n",
+		},
+		{
+			name: "CRLF line endings",
+			a:    "a\r\nb\r\n",
+			b:    "a\nb\nc\n",
+			want: " a\n b\n+c\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := unified(Lines(tt.a, tt.b))
+			if got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHunks(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12"
+	b := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve"
+
+	hunks := Hunks(Lines(a, b), 1)
+	if len(hunks) != 2 {
+		t.Fatalf("got %d hunks; want 2", len(hunks))
+	}
+
+	want := []string{"@@ -2,3 +2,3 @@", "@@ -11,2 +11,2 @@"}
+	for i, h := range hunks {
+		if h.Header() != want[i] {
+			t.Errorf("got %q; want %q", h.Header(), want[i])
+		}
+	}
+
+	// with a bigger context the two changes share a single hunk
+	hunks = Hunks(Lines(a, b), 5)
+	if len(hunks) != 1 {
+		t.Fatalf("got %d hunks; want 1", len(hunks))
+	}
+	if hunks[0].Header() != "@@ -1,12 +1,12 @@" {
+		t.Errorf("got %q; want %q", hunks[0].Header(), "@@ -1,12 +1,12 @@")
+	}
+}
@@ -0,0 +1,43 @@
+package highlight
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2/lexers"
+)
+
+func TestLanguagesHaveLexers(t *testing.T) {
+	for _, l := range Languages {
+		if l.Name == "" {
+			continue
+		}
+		if lexers.Get(l.Name) == nil {
+			t.Errorf("no lexer for %q", l.Name)
+		}
+	}
+}
+
+func TestHTML(t *testing.T) {
+	code := "<script>alert(1)</script>\r\necho \"hi\"\r\n"
+
+	for _, language := range []string{"", "bash", "html", "unknown"} {
+		t.Run(language, func(t *testing.T) {
+			got, err := HTML(code, language)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the Content-Security-Policy forbids inline styles, and the
+			// code must come out escaped
+			for _, unwanted := range []string{"style=", "<script>", "\r"} {
+				if strings.Contains(got, unwanted) {
+					t.Errorf("got %q; want no %q", got, unwanted)
+				}
+			}
+			if !strings.Contains(got, `<span class="ln">2</span>`) {
+				t.Errorf("got %q; want line numbers", got)
+			}
+		})
+	}
+}
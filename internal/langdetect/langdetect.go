@@ -0,0 +1,351 @@
+// Package langdetect guesses the programming language of a snippet from its
+// content and title. Language names are the ones used by the highlight
+// package, the empty string meaning plain text.
+package langdetect
+
+import (
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"math"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// confidence of the different kinds of evidence. Keyword counting never gets
+// as sure as an explicit hint or a successful parse.
+const (
+	shebangConfidence   = 0.95
+	parseConfidence     = 0.95
+	extensionConfidence = 0.9
+	fragmentConfidence  = 0.9
+	maxKeywordScore     = 0.85
+	// below this, the content is considered plain text
+	minConfidence = 0.3
+)
+
+// Detect returns the most likely language of a snippet, along with a
+// confidence between 0 and 1. It looks in order for a shebang line, a file
+// name in the title, content that parses as JSON or Go, and finally for the
+// keywords and constructs typical of each language.
+func Detect(title, content string) (language string, confidence float64) {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+
+	if language, ok := fromShebang(content); ok {
+		return language, shebangConfidence
+	}
+	if language, ok := fromTitle(title); ok {
+		return language, extensionConfidence
+	}
+
+	trimmed := strings.TrimSpace(content)
+	if trimmed == "" {
+		return "", 0
+	}
+	if (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid([]byte(trimmed)) {
+		return "json", parseConfidence
+	}
+	if parsesAsGo(content, false) {
+		return "go", parseConfidence
+	}
+
+	language, confidence = fromKeywords(content)
+
+	// Go fragments, such as a function or a few statements, don't parse
+	// as a file. They're recognized when they parse once wrapped, as long
+	// as they look like Go in the first place: plenty of one-liners in
+	// other languages are valid Go expressions.
+	if language == "go" && parsesAsGo(content, true) {
+		confidence = max(confidence, fragmentConfidence)
+	}
+
+	if confidence < minConfidence {
+		return "", 0
+	}
+	return language, confidence
+}
+
+var interpreters = map[string]string{
+	"sh":      "bash",
+	"bash":    "bash",
+	"zsh":     "bash",
+	"dash":    "bash",
+	"ksh":     "bash",
+	"python":  "python",
+	"python2": "python",
+	"python3": "python",
+	"node":    "javascript",
+	"deno":    "typescript",
+	"ts-node": "typescript",
+	"ruby":    "ruby",
+	"php":     "php",
+	"pwsh":    "powershell",
+	"make":    "makefile",
+}
+
+// fromShebang looks at the interpreter named by a #! first line, following
+// /usr/bin/env indirections
+func fromShebang(content string) (string, bool) {
+	if !strings.HasPrefix(content, "#!") {
+		return "", false
+	}
+	line, _, _ := strings.Cut(content[2:], "\n")
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", false
+	}
+	interpreter := path.Base(fields[0])
+	if interpreter == "env" {
+		// skip env options such as -S
+		for _, f := range fields[1:] {
+			if !strings.HasPrefix(f, "-") {
+				interpreter = f
+				break
+			}
+		}
+	}
+
+	language, ok := interpreters[interpreter]
+	return language, ok
+}
+
+var extensions = map[string]string{
+	".sh":         "bash",
+	".bash":       "bash",
+	".zsh":        "bash",
+	".c":          "c",
+	".h":          "c",
+	".cpp":        "cpp",
+	".cc":         "cpp",
+	".hpp":        "cpp",
+	".css":        "css",
+	".diff":       "diff",
+	".patch":      "diff",
+	".go":         "go",
+	".html":       "html",
+	".htm":        "html",
+	".ini":        "ini",
+	".java":       "java",
+	".js":         "javascript",
+	".mjs":        "javascript",
+	".json":       "json",
+	".md":         "markdown",
+	".php":        "php",
+	".ps1":        "powershell",
+	".py":         "python",
+	".rb":         "ruby",
+	".rs":         "rust",
+	".sql":        "sql",
+	".tf":         "terraform",
+	".toml":       "toml",
+	".ts":         "typescript",
+	".yml":        "yaml",
+	".yaml":       "yaml",
+	"dockerfile":  "docker",
+	"makefile":    "makefile",
+	"gnumakefile": "makefile",
+	"nginx.conf":  "nginx",
+}
+
+// fromTitle looks for a word of the title which looks like a file name
+func fromTitle(title string) (string, bool) {
+	for _, word := range strings.Fields(strings.ToLower(title)) {
+		word = strings.Trim(word, `"'()[],:;`)
+		if language, ok := extensions[word]; ok {
+			return language, true
+		}
+		if i := strings.LastIndexByte(word, '.'); i > 0 {
+			if language, ok := extensions[word[i:]]; ok {
+				return language, true
+			}
+		}
+	}
+	return "", false
+}
+
+// parsesAsGo returns true if content is a valid Go source file. If fragment
+// is true, content may also be a list of declarations without a package
+// clause, or a list of statements.
+func parsesAsGo(content string, fragment bool) bool {
+	fset := token.NewFileSet()
+	if _, err := parser.ParseFile(fset, "", content, parser.SkipObjectResolution); err == nil {
+		return true
+	}
+	if !fragment {
+		return false
+	}
+	if _, err := parser.ParseFile(fset, "", "package p\n"+content, parser.SkipObjectResolution); err == nil {
+		return true
+	}
+	_, err := parser.ParseFile(fset, "", "package p\nfunc _() {\n"+content+"\n}", parser.SkipObjectResolution)
+	return err == nil
+}
+
+// a rule is a pattern typical of a language, with how much it counts
+type rule struct {
+	rx     *regexp.Regexp
+	weight float64
+}
+
+func rules(weight float64, patterns ...string) []rule {
+	rs := make([]rule, len(patterns))
+	for i, p := range patterns {
+		rs[i] = rule{regexp.MustCompile(p), weight}
+	}
+	return rs
+}
+
+// profiles lists, for each language, strong (3), medium (2) and weak (1)
+// signs of it. Patterns are matched against the whole content in multi-line
+// mode.
+var profiles = map[string][]rule{
+	"bash": concat(
+		rules(3, `(?m)^\s*(fi|done|esac)\s*$`, `(?m)^\s*if \[\[? `, `\$\{[A-Za-z_][A-Za-z0-9_]*(:-[^}]*)?\}`),
+		rules(2, `(?m)^\s*(echo|export|sudo|apt-get|apt|yum|curl|wget|cd|chmod|mkdir|grep|kubectl|docker|systemctl) `, `\$\(`, `(?m); then$`, ` \|\| exit`, `(?m)^\s*set -[euxo]`),
+		rules(1, `\|\s*(grep|awk|sed|xargs|sort|uniq|wc|head|tail)\b`, `\$[A-Z_]{2,}`, `&&\s*$`),
+	),
+	"c": concat(
+		rules(3, `(?m)^#include <(stdio|stdlib|string|unistd)\.h>`, `\bint main\s*\(`),
+		rules(2, `\bprintf\s*\(`, `\bmalloc\s*\(`, `\bstruct \w+ \{`, `(?m)^#define `),
+		rules(1, `\bsizeof\b`, `->`, `\bNULL\b`),
+	),
+	"cpp": concat(
+		rules(3, `\bstd::`, `#include <(iostream|vector|string|map|memory)>`, `\bcout\s*<<`),
+		rules(2, `\btemplate\s*<`, `\bnamespace \w+`, `\bclass \w+\s*(:|\{)`),
+		rules(1, `\bnullptr\b`, `\bauto\b`),
+	),
+	"css": concat(
+		rules(3, `(?m)^\s*[.#]?[a-zA-Z][\w\-.#: >]*\s*\{\s*$`, `@media\b`),
+		rules(2, `(?m)^\s*(color|margin|padding|display|font-\w+|background(-\w+)?|border(-\w+)?|width|height)\s*:[^;]+;`),
+		rules(1, `\b\d+(px|em|rem|vh|vw)\b`, `#[0-9a-fA-F]{3,6}\b`),
+	),
+	"diff": concat(
+		rules(3, `(?m)^@@ -\d+(,\d+)? \+\d+(,\d+)? @@`, `(?m)^(\+\+\+|---) \S`, `(?m)^diff --git `),
+		rules(1, `(?m)^[+-][^+-]`),
+	),
+	"docker": concat(
+		rules(3, `(?m)^FROM \S+`, `(?m)^(RUN|COPY|ENTRYPOINT|CMD|WORKDIR|EXPOSE|ENV|ARG) `),
+	),
+	"go": concat(
+		rules(3, `(?m)^package \w+`, `\bfunc (\(\w+ \*?\w+\) )?\w+\(`, `\berr != nil\b`, `:= `),
+		rules(2, `(?m)^import \(`, `\bfmt\.\w+\(`, `\bdefer \w`, `\bchan \w`, `\bgo func\(`),
+		rules(1, `\bnil\b`, `\[\]\w+`, `\bstruct \{`),
+	),
+	"html": concat(
+		rules(3, `(?i)<!doctype html`, `(?i)<html\b`, `(?i)</(div|body|head|p|span|ul|li|table|a)>`),
+		rules(2, `(?i)<(div|span|p|a|img|script|link|meta|ul|li|table|form|input)\b[^>]*>`),
+		rules(1, `\b(class|href|src)="`),
+	),
+	"java": concat(
+		rules(3, `\bpublic (static )?(class|void|interface)\b`, `\bSystem\.out\.print`),
+		rules(2, `(?m)^import java\.`, `\b(private|protected) \w+ \w+`, `@Override\b`),
+		rules(1, `\bnew \w+\(`, `\bString\[\]`),
+	),
+	"javascript": concat(
+		rules(3, `\bconsole\.log\(`, `\bfunction\s*\w*\s*\(`, `\brequire\(['"]`, `\bdocument\.\w+`),
+		rules(2, `\b(const|let) \w+ = `, `=>`, `\bmodule\.exports\b`, `(?m)^import .* from ['"]`),
+		rules(1, `===`, `\bundefined\b`, `\basync\b`, `\bawait\b`),
+	),
+	"makefile": concat(
+		rules(3, `(?m)^\.PHONY:`, `(?m)^[\w.-]+:( [\w.$()/-]+)*\n\t`),
+		rules(2, `\$\(\w+\)`, `(?m)^\w+ :?= `),
+	),
+	"markdown": concat(
+		rules(3, `(?m)^#{1,6} \S`, "(?m)^```"),
+		rules(2, `\[[^\]]+\]\([^)]+\)`, `(?m)^\s*[-*] \S`, `(?m)^\|.*\|$`),
+		rules(1, `\*\*\S[^*]*\*\*`, "`[^`]+`"),
+	),
+	"nginx": concat(
+		rules(3, `(?m)^\s*server\s*\{`, `(?m)^\s*location\s+\S+\s*\{`, `\bproxy_pass\b`),
+		rules(2, `(?m)^\s*(listen|server_name|root|upstream|add_header)\s+[^;]+;`),
+	),
+	"php": concat(
+		rules(3, `<\?php`, `\$this->`),
+		rules(2, `\becho \$`, `\bfunction \w+\(\$`, `\$\w+ = `),
+	),
+	"powershell": concat(
+		rules(3, `\b(Get|Set|New|Remove|Write|Invoke)-[A-Z]\w+`, `\$PSVersionTable`),
+		rules(2, ` -(eq|ne|gt|lt|like|match) `, `\$env:\w+`),
+	),
+	"python": concat(
+		rules(3, `(?m)^\s*def \w+\(.*\):\s*$`, `(?m)^\s*(from \w+(\.\w+)* )?import \w+`, `\bself\.\w+`, `__name__ == ['"]__main__['"]`),
+		rules(2, `(?m)^\s*(class \w+(\(.*\))?|elif .*|else|try|except.*|for .* in .*|while .*|with .*):\s*$`, `\bprint\(`, `\bNone\b`),
+		rules(1, `\b(True|False)\b`, `\blambda\b`, `#.*$`),
+	),
+	"ruby": concat(
+		rules(3, `(?m)^\s*end\s*$`, `\bdo \|\w+(, ?\w+)*\|`, `(?m)^\s*require ['"]`),
+		rules(2, `(?m)^\s*def \w+[?!]?(\(.*\))?\s*$`, `\bputs `, `(?m)^\s*class \w+( < \w+)?\s*$`),
+		rules(1, `:\w+ =>`, `@\w+`),
+	),
+	"rust": concat(
+		rules(3, `\bfn \w+(<.*>)?\(`, `\blet mut\b`, `\bprintln!\(`, `\bimpl\b`),
+		rules(2, `\buse \w+::`, `\bpub (fn|struct|enum)\b`, `&mut\b`, `\bmatch \w+ \{`),
+		rules(1, `::`, `\bSome\(`, `\bOk\(`),
+	),
+	"sql": concat(
+		rules(3, `(?i)\bselect\b[\s\S]+?\bfrom\b`, `(?i)\binsert into\b`, `(?i)\bcreate (table|index|view|database)\b`, `(?i)\bupdate \w+ set\b`),
+		rules(2, `(?i)\b(where|group by|order by|inner join|left join|alter table|delete from|values)\b`),
+		rules(1, `(?i)\b(and|or|not null|primary key|limit)\b`),
+	),
+	"terraform": concat(
+		rules(3, `(?m)^(resource|data) "\w+" "\w+" \{`, `(?m)^(variable|output|provider|module) "\w+" \{`),
+		rules(2, `\bvar\.\w+`, `(?m)^terraform \{`),
+	),
+	"toml": concat(
+		rules(3, `(?m)^\[\[?[\w.-]+\]\]?\s*$`),
+		rules(2, `(?m)^[\w.-]+ = ("|\d|\[|true|false)`),
+	),
+	"typescript": concat(
+		rules(3, `\binterface \w+ \{`, `: (string|number|boolean|void)\b`, `\btype \w+ = `),
+		rules(2, `\b(export|import) .* from ['"]`, `\b(private|public|readonly) \w+:`),
+		rules(1, `\bconst \w+ = `, `=>`),
+	),
+	"yaml": concat(
+		rules(3, `(?m)^---\s*$`, `(?m)^(apiVersion|kind|services|version|jobs|steps):`),
+		rules(2, `(?m)^\s*[\w.-]+:\s+\S`, `(?m)^\s*- [\w.-]+:\s`),
+		rules(1, `(?m)^\s*- \S`, `(?m)^\s*[\w.-]+:\s*$`),
+	),
+}
+
+func concat(groups ...[]rule) []rule {
+	var all []rule
+	for _, g := range groups {
+		all = append(all, g...)
+	}
+	return all
+}
+
+// each pattern counts for at most this many matches, so that a long snippet
+// repeating a construct doesn't drown out everything else
+const maxMatches = 3
+
+// fromKeywords scores every language on how many of its typical patterns
+// appear in content. The confidence depends both on how far ahead the best
+// language is, and on how much evidence there is overall.
+func fromKeywords(content string) (string, float64) {
+	var best string
+	var bestScore, total float64
+
+	for language, rs := range profiles {
+		score := 0.0
+		for _, r := range rs {
+			n := len(r.rx.FindAllStringIndex(content, maxMatches))
+			score += r.weight * float64(n)
+		}
+		total += score
+		// ties are broken by name to keep results deterministic
+		if score > bestScore || (score == bestScore && score > 0 && language < best) {
+			best, bestScore = language, score
+		}
+	}
+
+	if bestScore == 0 {
+		return "", 0
+	}
+
+	share := bestScore / total
+	strength := 1 - math.Exp(-bestScore/6)
+	return best, math.Round(maxKeywordScore*share*strength*100) / 100
+}
@@ -0,0 +1,121 @@
+package langdetect
+
+import (
+	"testing"
+
+	"snippetbox.cnoua.org/internal/highlight"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name    string
+		title   string
+		content string
+		want    string
+	}{
+		{
+			name:    "Shebang",
+			title:   "Cleanup",
+			content: "#!/usr/bin/env python3\nprint('hi')\n",
+			want:    "python",
+		},
+		{
+			name:    "File name in title",
+			title:   "our nginx.conf",
+			content: "anything",
+			want:    "nginx",
+		},
+		{
+			name:    "Extension in title",
+			title:   "backup.sh (runs nightly)",
+			content: "anything",
+			want:    "bash",
+		},
+		{
+			name:    "JSON",
+			content: `{"name": "snippetbox", "private": true}`,
+			want:    "json",
+		},
+		{
+			name:    "Go file",
+			content: "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n",
+			want:    "go",
+		},
+		{
+			name:    "Go statements",
+			content: "rows, err := db.Query(stmt)\nif err != nil {\n\treturn err\n}\ndefer rows.Close()\n",
+			want:    "go",
+		},
+		{
+			name:    "SQL",
+			content: "SELECT id, title FROM snippets\nWHERE expires > UTC_TIMESTAMP()\nORDER BY id DESC LIMIT 10;",
+			want:    "sql",
+		},
+		{
+			name:    "Shell without shebang",
+			content: "set -euo pipefail\nfor f in *.log; do\n  gzip \"$f\"\ndone\nif [ -d /tmp/x ]; then\n  echo ok\nfi\n",
+			want:    "bash",
+		},
+		{
+			name:    "Python",
+			content: "import os\n\ndef main():\n    for name in os.listdir('.'):\n        print(name)\n\nif __name__ == '__main__':\n    main()\n",
+			want:    "python",
+		},
+		{
+			name:    "YAML",
+			content: "services:\n  web:\n    image: nginx:latest\n    ports:\n      - \"80:80\"\n",
+			want:    "yaml",
+		},
+		{
+			name:    "Dockerfile",
+			content: "FROM golang:1.22\nWORKDIR /src\nCOPY . .\nRUN go build ./cmd/web\nCMD [\"./web\"]\n",
+			want:    "docker",
+		},
+		{
+			name:    "JavaScript",
+			content: "const express = require('express');\nconst app = express();\napp.get('/', (req, res) => {\n  console.log('hit');\n});\n",
+			want:    "javascript",
+		},
+		{
+			name:    "Prose",
+			content: "Remember to rotate the on-call schedule before the holidays.",
+			want:    "",
+		},
+		{
+			name:    "Empty",
+			content: "  \n",
+			want:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, confidence := Detect(tt.title, tt.content)
+			if got != tt.want {
+				t.Errorf("got %q (%.2f); want %q", got, confidence, tt.want)
+			}
+			if got != "" && (confidence < minConfidence || confidence > 1) {
+				t.Errorf("got confidence %.2f; want between %.2f and 1", confidence, minConfidence)
+			}
+		})
+	}
+}
+
+func TestDetectedLanguagesAreSupported(t *testing.T) {
+	var languages []string
+	for _, l := range interpreters {
+		languages = append(languages, l)
+	}
+	for _, l := range extensions {
+		languages = append(languages, l)
+	}
+	for l := range profiles {
+		languages = append(languages, l)
+	}
+
+	for _, l := range append(languages, "json", "go") {
+		if !highlight.Supported(l) {
+			t.Errorf("%q isn't supported by the highlighter", l)
+		}
+	}
+}
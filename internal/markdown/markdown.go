@@ -0,0 +1,89 @@
+// Package markdown renders GitHub flavoured markdown snippets as HTML that's
+// safe to include in a page. Fenced code blocks go through the highlight
+// package, and the output is filtered by an allow-list sanitizer.
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+
+	"snippetbox.cnoua.org/internal/highlight"
+)
+
+// md converts markdown with the GFM extensions: tables, strikethrough, task
+// lists and auto-linked URLs. Raw HTML in the source isn't rendered.
+var md = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithRendererOptions(
+		renderer.WithNodeRenderers(util.Prioritized(&codeBlockRenderer{}, 100)),
+	),
+)
+
+// policy is the allow-list the rendered HTML goes through. It's based on the
+// bluemonday policy for user generated content, which keeps formatting,
+// tables and links but drops scripts, event handlers, inline styles and
+// dangerous URLs. The classes used by the highlighter are allowed on top of it.
+var policy = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^[a-z0-9]+( [a-z0-9]+)*$`)).OnElements("pre", "code", "span")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	return p
+}()
+
+// Render converts markdown source to sanitized HTML
+func Render(source string) (string, error) {
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+	return policy.Sanitize(buf.String()), nil
+}
+
+// codeBlockRenderer renders fenced code blocks with syntax highlighting,
+// using the language given after the opening fence
+type codeBlockRenderer struct{}
+
+func (r *codeBlockRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, r.renderFencedCodeBlock)
+}
+
+func (r *codeBlockRenderer) renderFencedCodeBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	n := node.(*ast.FencedCodeBlock)
+
+	var code bytes.Buffer
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		code.Write(line.Value(source))
+	}
+
+	language := ""
+	if n.Info != nil {
+		language = string(n.Language(source))
+	}
+
+	html, err := highlight.HTML(code.String(), language)
+	if err != nil {
+		return ast.WalkStop, err
+	}
+
+	_, err = w.WriteString(html)
+	if err != nil {
+		return ast.WalkStop, err
+	}
+
+	return ast.WalkSkipChildren, nil
+}
@@ -0,0 +1,71 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		want     []string
+		unwanted []string
+	}{
+		{
+			name:   "Headings and lists",
+			source: "# Runbook\n\n- one\n- two\n",
+			want:   []string{"<h1>Runbook</h1>", "<li>one</li>"},
+		},
+		{
+			name:   "Table",
+			source: "| a | b |\n|---|---|\n| 1 | 2 |\n",
+			want:   []string{"<table>", "<th>a</th>", "<td>2</td>"},
+		},
+		{
+			name:     "Fenced code",
+			source:   "```go\nfunc main() {}\n```\n",
+			want:     []string{`<pre class="chroma">`, `<span class="kd">func</span>`},
+			unwanted: []string{"style="},
+		},
+		{
+			name:   "Autolink",
+			source: "see https://example.com/docs",
+			want:   []string{`<a href="https://example.com/docs"`, `rel="nofollow noopener"`},
+		},
+		{
+			name:     "Raw HTML",
+			source:   "<script>alert(1)</script>\n\n<img src=x onerror=alert(1)>\n\n<p style=\"color: red\">x</p>",
+			unwanted: []string{"<script", "onerror", "style="},
+		},
+		{
+			name:     "Dangerous links",
+			source:   "[click](javascript:alert(1)) ![x](data:text/html;base64,PHNjcmlwdD4=)",
+			unwanted: []string{"javascript:", "data:"},
+		},
+		{
+			name:     "Code block classes",
+			source:   "```go onclick=alert(1)\nx\n```\n",
+			unwanted: []string{"onclick"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(got, s) {
+					t.Errorf("got %q; want it to contain %q", got, s)
+				}
+			}
+			for _, s := range tt.unwanted {
+				if strings.Contains(got, s) {
+					t.Errorf("got %q; want no %q", got, s)
+				}
+			}
+		})
+	}
+}
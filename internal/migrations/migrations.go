@@ -0,0 +1,288 @@
+// Package migrations holds the versioned changes of the database schema, for
+// each SQL dialect, and applies them. The applied versions are recorded in
+// the schema_migrations table.
+//
+// A migration is a pair of files in the directory of the dialect, named
+// after the version and a description: 0001_create_users_snippets.up.sql
+// and 0001_create_users_snippets.down.sql. Versions are sequential, and a
+// migration is never changed once it's been released, a new one is added
+// instead.
+//
+// The first two migrations create the tables of the databases set up before
+// migrations existed, the users, snippets and sessions ones, unless they
+// exist already. Such databases are upgraded by applying every migration.
+package migrations
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed mysql postgres sqlite
+var files embed.FS
+
+// ErrNoMigration is returned when rolling back a database without any applied
+// migration
+var ErrNoMigration = errors.New("migrations: no migration to roll back")
+
+// Migration is a versioned change of the database schema. Applied is the
+// time the migration was applied at, the zero time if it's pending.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+	Applied time.Time
+}
+
+// fileRX matches the names of migration files
+var fileRX = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Load returns the migrations of the named dialect, by version
+func Load(dialect string) ([]*Migration, error) {
+	entries, err := fs.ReadDir(files, dialect)
+	if err != nil {
+		return nil, fmt.Errorf("migrations: unknown dialect %q", dialect)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		matches := fileRX.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("migrations: unexpected file %s/%s", dialect, entry.Name())
+		}
+
+		version, _ := strconv.Atoi(matches[1])
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		}
+
+		b, err := fs.ReadFile(files, path.Join(dialect, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if matches[3] == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for version := 1; version <= len(byVersion); version++ {
+		m, ok := byVersion[version]
+		if !ok {
+			return nil, fmt.Errorf("migrations: version %d of %s is missing", version, dialect)
+		}
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migrations: version %d of %s lacks its up or down file", version, dialect)
+		}
+		migrations = append(migrations, m)
+	}
+
+	return migrations, nil
+}
+
+// Migrator applies the migrations of a dialect to a database
+type Migrator struct {
+	DB         *sql.DB
+	Dialect    string
+	Migrations []*Migration
+}
+
+// New returns a migrator for a database of the named dialect: "mysql",
+// "postgres" or "sqlite"
+func New(db *sql.DB, dialect string) (*Migrator, error) {
+	migrations, err := Load(dialect)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, Dialect: dialect, Migrations: migrations}, nil
+}
+
+// placeholders returns the query placeholders of the migrator's dialect
+func (m *Migrator) placeholders(n int) []string {
+	p := make([]string, n)
+	for i := range p {
+		if m.Dialect == "postgres" {
+			p[i] = "$" + strconv.Itoa(i+1)
+		} else {
+			p[i] = "?"
+		}
+	}
+	return p
+}
+
+// init creates the schema_migrations table unless it already exists
+func (m *Migrator) init() error {
+	stmt := `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER NOT NULL PRIMARY KEY,
+	applied TIMESTAMP NOT NULL
+	)`
+
+	_, err := m.DB.Exec(stmt)
+	return err
+}
+
+// applied returns the applied time of the applied migrations by version
+func (m *Migrator) applied() (map[int]time.Time, error) {
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.DB.Query(`SELECT version, applied FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var t time.Time
+		if err = rows.Scan(&version, &t); err != nil {
+			return nil, err
+		}
+		applied[version] = t
+	}
+
+	return applied, rows.Err()
+}
+
+// Status returns the migrations, with the time they were applied at
+func (m *Migrator) Status() ([]*Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]*Migration, len(m.Migrations))
+	for i, migration := range m.Migrations {
+		c := *migration
+		c.Applied = applied[c.Version]
+		status[i] = &c
+	}
+
+	return status, nil
+}
+
+// Pending returns the migrations which haven't been applied yet
+func (m *Migrator) Pending() ([]*Migration, error) {
+	status, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(status, func(migration *Migration) bool {
+		return !migration.Applied.IsZero()
+	}), nil
+}
+
+// Up applies the pending migrations in order, and returns them
+func (m *Migrator) Up() ([]*Migration, error) {
+	pending, err := m.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	p := m.placeholders(2)
+	stmt := `INSERT INTO schema_migrations (version, applied) VALUES (` + p[0] + `, ` + p[1] + `)`
+
+	for i, migration := range pending {
+		err = m.run(migration.Up, stmt, migration.Version, time.Now().UTC().Truncate(time.Second))
+		if err != nil {
+			return pending[:i], fmt.Errorf("migrations: applying %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+	}
+
+	return pending, nil
+}
+
+// Down rolls back the latest applied migration, and returns it. It returns
+// ErrNoMigration if no migration is applied.
+func (m *Migrator) Down() (*Migration, error) {
+	status, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	i := slices.IndexFunc(status, func(migration *Migration) bool {
+		return migration.Applied.IsZero()
+	})
+	if i == -1 {
+		i = len(status)
+	}
+	if i == 0 {
+		return nil, ErrNoMigration
+	}
+	migration := status[i-1]
+
+	stmt := `DELETE FROM schema_migrations WHERE version = ` + m.placeholders(1)[0]
+
+	err = m.run(migration.Down, stmt, migration.Version)
+	if err != nil {
+		return nil, fmt.Errorf("migrations: rolling back %04d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	return migration, nil
+}
+
+// run executes the statements of a migration file, then the statement
+// recording it in schema_migrations, in a transaction. MySQL commits
+// implicitly after each schema change though, so a failing migration can be
+// left half applied there.
+func (m *Migrator) run(script, record string, args ...any) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range statements(script) {
+		if _, err = tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	if _, err = tx.Exec(record, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// statements splits a migration file into its statements, which end with a
+// semicolon at the end of a line. Lines starting with -- are comments.
+func statements(script string) []string {
+	var stmts []string
+	var b strings.Builder
+
+	for line := range strings.Lines(script) {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		b.WriteString(line)
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSpace(b.String()))
+			b.Reset()
+		}
+	}
+	if s := strings.TrimSpace(b.String()); s != "" {
+		stmts = append(stmts, s)
+	}
+
+	return stmts
+}
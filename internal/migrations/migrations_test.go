@@ -0,0 +1,182 @@
+package migrations
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestLoad(t *testing.T) {
+	var versions [][]string
+	for _, dialect := range []string{"mysql", "postgres", "sqlite"} {
+		migrations, err := Load(dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// every dialect has the same migrations
+		names := []string{}
+		for i, m := range migrations {
+			if m.Version != i+1 {
+				t.Errorf("got version %d at index %d of %s", m.Version, i, dialect)
+			}
+			names = append(names, m.Name)
+		}
+		versions = append(versions, names)
+	}
+
+	if !slices.Equal(versions[0], versions[1]) || !slices.Equal(versions[0], versions[2]) {
+		t.Errorf("got different migrations by dialect: %v", versions)
+	}
+
+	if _, err := Load("oracle"); err == nil {
+		t.Error("got no error for an unknown dialect")
+	}
+}
+
+func TestStatements(t *testing.T) {
+	script := `-- a comment
+CREATE TABLE a (
+    id INTEGER
+);
+
+CREATE INDEX a_idx ON a (id);
+`
+	got := statements(script)
+	want := []string{"CREATE TABLE a (\n    id INTEGER\n);", "CREATE INDEX a_idx ON a (id);"}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	db, err := sql.Open("sqlite", "file::memory:?_pragma=foreign_keys(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	m, err := New(db, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := m.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(m.Migrations) {
+		t.Errorf("applied %d migrations; want %d", len(applied), len(m.Migrations))
+	}
+
+	// applying twice is a no-op
+	applied, err = m.Up()
+	if err != nil || len(applied) != 0 {
+		t.Errorf("got %d migrations, %v applying again; want none", len(applied), err)
+	}
+
+	latest, err := m.Down()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Version != len(m.Migrations) {
+		t.Errorf("rolled back version %d; want %d", latest.Version, len(m.Migrations))
+	}
+
+	pending, err := m.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Version != latest.Version {
+		t.Errorf("got pending %+v; want version %d", pending, latest.Version)
+	}
+
+	// every down migration undoes its up migration
+	for range len(m.Migrations) - 1 {
+		if _, err = m.Down(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = m.Down(); !errors.Is(err, ErrNoMigration) {
+		t.Errorf("got error %v; want %v", err, ErrNoMigration)
+	}
+
+	var tables int
+	err = db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT IN ('schema_migrations', 'sqlite_sequence')`).Scan(&tables)
+	if err != nil || tables != 0 {
+		t.Errorf("got %d tables, %v after rolling back everything; want none", tables, err)
+	}
+
+	status, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range status {
+		if !s.Applied.IsZero() {
+			t.Errorf("got migration %d applied at %v; want it pending", s.Version, s.Applied)
+		}
+	}
+}
+
+func TestMigratorBaseline(t *testing.T) {
+	db, err := sql.Open("sqlite", "file::memory:?_pragma=foreign_keys(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	// the schema of the databases set up before migrations existed, with a
+	// snippet of before ownership was recorded
+	for _, stmt := range []string{
+		`CREATE TABLE snippets (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			title TEXT NOT NULL,
+			content TEXT NOT NULL,
+			created DATETIME NOT NULL,
+			expires DATETIME NOT NULL
+		)`,
+		`CREATE INDEX idx_snippets_created ON snippets (created)`,
+		`CREATE TABLE sessions (token TEXT PRIMARY KEY, data BLOB NOT NULL, expiry REAL NOT NULL)`,
+		`CREATE INDEX sessions_expiry_idx ON sessions (expiry)`,
+		`CREATE TABLE users (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			email TEXT NOT NULL,
+			hashed_password TEXT NOT NULL,
+			created DATETIME NOT NULL,
+			CONSTRAINT users_uc_email UNIQUE (email)
+		)`,
+		`INSERT INTO snippets (title, content, created, expires) VALUES ('Hello', 'hello', '2024-01-01 00:00:00', '2034-01-01 00:00:00')`,
+	} {
+		if _, err = db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := New(db, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Up(); err != nil {
+		t.Fatalf("upgrading a database of before migrations: %v", err)
+	}
+
+	// the snippet gets the defaults of the columns added since
+	var userID sql.NullInt64
+	var language, contentType string
+	var confidence float64
+	err = db.QueryRow(`SELECT user_id, language, language_confidence, content_type FROM snippets WHERE title = 'Hello'`).
+		Scan(&userID, &language, &confidence, &contentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID.Valid || language != "" || confidence != 1 || contentType != "text" {
+		t.Errorf("got user %v, language %q (%v), content type %q; want the defaults", userID, language, confidence, contentType)
+	}
+}
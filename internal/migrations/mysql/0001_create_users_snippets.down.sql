@@ -0,0 +1,3 @@
+DROP TABLE snippets;
+
+DROP TABLE users;
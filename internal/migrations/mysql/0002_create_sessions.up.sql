@@ -0,0 +1,8 @@
+-- the table of the scs mysqlstore session store, which databases set up
+-- before migrations existed already have
+CREATE TABLE IF NOT EXISTS sessions (
+    token CHAR(43) PRIMARY KEY,
+    data BLOB NOT NULL,
+    expiry TIMESTAMP(6) NOT NULL,
+    INDEX sessions_expiry_idx (expiry)
+);
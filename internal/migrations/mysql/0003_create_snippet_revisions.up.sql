@@ -0,0 +1,15 @@
+CREATE TABLE snippet_revisions (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT snippet_revisions_uc_version UNIQUE (snippet_id, version),
+    CONSTRAINT snippet_revisions_fk_snippet_id FOREIGN KEY (snippet_id) REFERENCES snippets (id)
+);
+
+-- the existing snippets start their history with their current title &
+-- content, so that their first edit keeps the original
+INSERT INTO snippet_revisions (snippet_id, version, title, content, created)
+SELECT id, 1, title, content, created FROM snippets;
@@ -0,0 +1,4 @@
+-- snippets created before ownership was recorded have no user
+ALTER TABLE snippets
+    ADD COLUMN user_id INTEGER,
+    ADD CONSTRAINT snippets_fk_user_id FOREIGN KEY (user_id) REFERENCES users (id);
@@ -0,0 +1,2 @@
+-- existing snippets are plain text
+ALTER TABLE snippets ADD COLUMN content_type VARCHAR(20) NOT NULL DEFAULT 'text';
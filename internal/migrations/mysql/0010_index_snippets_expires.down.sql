@@ -0,0 +1,3 @@
+CREATE INDEX idx_snippets_created ON snippets (created);
+
+DROP INDEX idx_snippets_expires ON snippets;
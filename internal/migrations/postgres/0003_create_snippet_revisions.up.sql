@@ -0,0 +1,14 @@
+CREATE TABLE snippet_revisions (
+    id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    snippet_id INTEGER NOT NULL REFERENCES snippets (id),
+    version INTEGER NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    created TIMESTAMP NOT NULL,
+    CONSTRAINT snippet_revisions_uc_version UNIQUE (snippet_id, version)
+);
+
+-- the existing snippets start their history with their current title &
+-- content, so that their first edit keeps the original
+INSERT INTO snippet_revisions (snippet_id, version, title, content, created)
+SELECT id, 1, title, content, created FROM snippets;
@@ -0,0 +1,10 @@
+CREATE TABLE tokens (
+    id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id),
+    name VARCHAR(100) NOT NULL,
+    hash BYTEA NOT NULL,
+    scopes VARCHAR(100) NOT NULL,
+    created TIMESTAMP NOT NULL,
+    last_used TIMESTAMP,
+    CONSTRAINT tokens_uc_hash UNIQUE (hash)
+);
@@ -0,0 +1,2 @@
+-- existing languages were picked by their authors
+ALTER TABLE snippets ADD COLUMN language_confidence DOUBLE PRECISION NOT NULL DEFAULT 1;
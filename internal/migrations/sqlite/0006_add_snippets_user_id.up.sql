@@ -0,0 +1,4 @@
+-- snippets created before ownership was recorded have no user
+ALTER TABLE snippets ADD COLUMN user_id INTEGER REFERENCES users (id);
+
+CREATE INDEX idx_snippets_user_id ON snippets (user_id);
@@ -0,0 +1,2 @@
+-- existing snippets have no language, they are shown without highlighting
+ALTER TABLE snippets ADD COLUMN language TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- the purge of expired snippets looks them up by expiry. No query orders
+-- the snippets by creation time, so the index on created is dropped.
+CREATE INDEX idx_snippets_expires ON snippets (expires);
+
+DROP INDEX idx_snippets_created;
@@ -0,0 +1 @@
+DROP INDEX idx_snippet_revisions_created;
@@ -0,0 +1,3 @@
+-- every instance of the application looks up the snippets changed since its
+-- last refresh of the search index by the time of their latest revision
+CREATE INDEX idx_snippet_revisions_created ON snippet_revisions (created);
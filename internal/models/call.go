@@ -0,0 +1,72 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName names the tracer of the spans of the SQL models
+const tracerName = "snippetbox.cnoua.org/internal/models"
+
+// startCall starts a call to a model method, named after the method, whose
+// statements run the given SQL operation: SELECT, INSERT, UPDATE or DELETE.
+// It starts the span of the call with a tracer of tp, or of the global tracer
+// provider if nil, and bounds ctx by timeout, unless zero. The global
+// provider is looked up on every call as it does nothing until the
+// application sets one up.
+//
+// The returned function must be called with the error the method returns,
+// and returns the error to return instead: a query cut short by the timeout
+// is reported as ErrTimeout.
+func (d *Dialect) startCall(ctx context.Context, tp trace.TracerProvider, name, operation string, timeout time.Duration) (context.Context, func(error) error) {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	ctx, span := tp.Tracer(tracerName).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system.name", d.system),
+			attribute.String("db.operation.name", operation),
+		),
+	)
+
+	cancel := func() {}
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	return ctx, func(err error) error {
+		// the drivers don't all wrap the error of the context, so the
+		// context itself tells whether its deadline is the cause
+		if err != nil && !isAnswer(err) && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("%w: %s: %w", ErrTimeout, name, err)
+		}
+		cancel()
+
+		endSpan(span, err)
+		return err
+	}
+}
+
+// endSpan ends the span of a call, marking it as failed if err is set and
+// isn't an answer
+func endSpan(span trace.Span, err error) {
+	if err != nil && !isAnswer(err) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// isAnswer returns true for the errors of this package which answer the call
+// rather than report a failure, like ErrNoRecord
+func isAnswer(err error) bool {
+	return errors.Is(err, ErrNoRecord) || errors.Is(err, ErrInvalidCredentials) || errors.Is(err, ErrDuplicateEmail)
+}
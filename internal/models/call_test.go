@@ -0,0 +1,81 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSpans(t *testing.T) {
+	db := newTestSQLiteDB(t)
+	userID := insertTestUser(t, db, "alice@example.com")
+	recorder := tracetest.NewSpanRecorder()
+	m := &SnippetModel{
+		DB:             db,
+		Dialect:        SQLite,
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)),
+	}
+
+	id, err := m.Insert(t.Context(), &Snippet{Title: "Hello", Content: "hello", ContentType: ContentTypeText, UserID: userID}, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Get(t.Context(), id+1); !errors.Is(err, ErrNoRecord) {
+		t.Fatalf("got error %v; want %v", err, ErrNoRecord)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans; want 2", len(spans))
+	}
+
+	for i, want := range []struct {
+		name, operation string
+	}{
+		{"SnippetModel.Insert", "INSERT"},
+		{"SnippetModel.Get", "SELECT"},
+	} {
+		span := spans[i]
+		if span.Name() != want.name {
+			t.Errorf("got span %q; want %q", span.Name(), want.name)
+		}
+
+		attrs := map[string]string{}
+		for _, attr := range span.Attributes() {
+			attrs[string(attr.Key)] = attr.Value.Emit()
+		}
+		if attrs["db.operation.name"] != want.operation || attrs["db.system.name"] != "sqlite" {
+			t.Errorf("got attributes %v for span %q", attrs, span.Name())
+		}
+		// a missing snippet isn't a failure
+		if span.Status().Code == codes.Error {
+			t.Errorf("got error status for span %q", span.Name())
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	db := newTestSQLiteDB(t)
+	userID := insertTestUser(t, db, "alice@example.com")
+
+	m := &SnippetModel{DB: db, Dialect: SQLite}
+	id, err := m.Insert(t.Context(), &Snippet{Title: "Hello", Content: "hello", ContentType: ContentTypeText, UserID: userID}, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the deadline has passed before the query starts
+	m.Timeout = time.Nanosecond
+	if _, err = m.Get(t.Context(), id); !errors.Is(err, ErrTimeout) {
+		t.Errorf("got error %v; want %v", err, ErrTimeout)
+	}
+
+	m.Timeout = time.Minute
+	if _, err = m.Get(t.Context(), id); err != nil {
+		t.Errorf("got error %v; want none", err)
+	}
+}
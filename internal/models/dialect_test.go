@@ -0,0 +1,94 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestRebind(t *testing.T) {
+	stmt := `SELECT id FROM snippets WHERE expires > ? AND id IN (?, ?) LIMIT ?`
+
+	if got := MySQL.rebind(stmt); got != stmt {
+		t.Errorf("got %q; want the statement unchanged", got)
+	}
+
+	want := `SELECT id FROM snippets WHERE expires > $1 AND id IN ($2, $3) LIMIT $4`
+	if got := Postgres.rebind(stmt); got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestInsertIgnore(t *testing.T) {
+	stmt := `INSERT INTO tags (name) VALUES (?)`
+
+	tests := []struct {
+		dialect *Dialect
+		want    string
+	}{
+		{MySQL, `INSERT IGNORE INTO tags (name) VALUES (?)`},
+		{SQLite, `INSERT INTO tags (name) VALUES (?) ON CONFLICT DO NOTHING`},
+		{Postgres, `INSERT INTO tags (name) VALUES (?) ON CONFLICT DO NOTHING`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dialect.Driver, func(t *testing.T) {
+			if got := tt.dialect.insertIgnore(stmt); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsUniqueViolation(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect *Dialect
+		err     error
+		want    bool
+	}{
+		{
+			name:    "MySQL duplicate email",
+			dialect: MySQL,
+			err:     &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a@b.c' for key 'users.users_uc_email'"},
+			want:    true,
+		},
+		{
+			name:    "MySQL other key",
+			dialect: MySQL,
+			err:     &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'PRIMARY'"},
+		},
+		{
+			name:    "Postgres duplicate email",
+			dialect: Postgres,
+			err:     fmt.Errorf("insert: %w", &pgconn.PgError{Code: "23505", ConstraintName: "users_uc_email"}),
+			want:    true,
+		},
+		{
+			name:    "Postgres other constraint",
+			dialect: Postgres,
+			err:     &pgconn.PgError{Code: "23505", ConstraintName: "tokens_uc_hash"},
+		},
+		{
+			name:    "Postgres not null violation",
+			dialect: Postgres,
+			err:     &pgconn.PgError{Code: "23502", ConstraintName: "users_uc_email"},
+		},
+		{
+			name:    "Other error",
+			dialect: Postgres,
+			err:     errors.New("connection refused"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.dialect.isUniqueViolation(tt.err, "users_uc_email"); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
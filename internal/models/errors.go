@@ -8,4 +8,7 @@ var (
 	ErrNoRecord           = errors.New("models: no matching record found")
 	ErrInvalidCredentials = errors.New("models: invalid credentials")
 	ErrDuplicateEmail     = errors.New("models: duplicate email")
+	// ErrTimeout is returned when the queries of a method take longer than
+	// the timeout of its model
+	ErrTimeout = errors.New("models: query timed out")
 )
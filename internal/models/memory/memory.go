@@ -0,0 +1,503 @@
+// Package memory implements the stores of the models package in memory. It
+// needs no database server, which makes it handy for development and tests,
+// but nothing survives a restart. The stores don't wait on anything, so they
+// ignore the contexts they're given.
+package memory
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"snippetbox.cnoua.org/internal/models"
+	"snippetbox.cnoua.org/internal/search"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DB holds all the records, guarded by a single mutex. The records are
+// copied in and out, so callers can't change them behind the store's back.
+type DB struct {
+	mu        sync.RWMutex
+	snippets  map[int]*models.Snippet
+	revisions map[int][]*models.Revision
+	users     map[int]*models.User
+	tokens    map[int]*token
+	index     *search.Index
+	lastID    int
+}
+
+// token is a stored API token, along with the hash of the token itself
+type token struct {
+	models.Token
+	hash []byte
+}
+
+// New returns an empty in-memory database
+func New() *DB {
+	return &DB{
+		snippets:  map[int]*models.Snippet{},
+		revisions: map[int][]*models.Revision{},
+		users:     map[int]*models.User{},
+		tokens:    map[int]*token{},
+		index:     search.NewIndex(),
+	}
+}
+
+// nextID returns a new record ID. IDs are shared by all the record types,
+// which keeps them unique and increasing like database sequences.
+func (db *DB) nextID() int {
+	db.lastID++
+	return db.lastID
+}
+
+// Snippets returns the snippet store of db
+func (db *DB) Snippets() *SnippetStore {
+	return &SnippetStore{db: db}
+}
+
+// Revisions returns the revision store of db
+func (db *DB) Revisions() *RevisionStore {
+	return &RevisionStore{db: db}
+}
+
+// Users returns the user store of db
+func (db *DB) Users() *UserStore {
+	return &UserStore{db: db}
+}
+
+// Tokens returns the API token store of db
+func (db *DB) Tokens() *TokenStore {
+	return &TokenStore{db: db}
+}
+
+// check at compile time that the stores implement the models interfaces
+var (
+	_ models.SnippetStore  = (*SnippetStore)(nil)
+	_ models.RevisionStore = (*RevisionStore)(nil)
+	_ models.UserStore     = (*UserStore)(nil)
+	_ models.TokenStore    = (*TokenStore)(nil)
+)
+
+// SnippetStore implements models.SnippetStore
+type SnippetStore struct {
+	db *DB
+}
+
+// copySnippet returns a copy of s, with the name of its author
+func (db *DB) copySnippet(s *models.Snippet) *models.Snippet {
+	c := *s
+	c.Tags = slices.Clone(s.Tags)
+	if u, ok := db.users[s.UserID]; ok {
+		c.UserName = u.Name
+	}
+	return &c
+}
+
+// live returns true if s hasn't expired yet
+func live(s *models.Snippet) bool {
+	return s.Expires.After(models.Now())
+}
+
+func (m *SnippetStore) Insert(ctx context.Context, s *models.Snippet, expires int) (int, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	c := *s
+	c.ID = m.db.nextID()
+	c.Created = models.Now()
+	c.Expires = models.ExpiryTime(c.Created, expires)
+	c.UserName = ""
+	c.Tags = sortedTags(s.Tags)
+	m.db.snippets[c.ID] = &c
+
+	m.db.addRevision(&c)
+	m.db.index.Add(c.ID, c.Title, c.Content)
+
+	return c.ID, nil
+}
+
+func (m *SnippetStore) Update(ctx context.Context, s *models.Snippet, expires int) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	stored, ok := m.db.snippets[s.ID]
+	if !ok {
+		return models.ErrNoRecord
+	}
+
+	stored.Title = s.Title
+	stored.Content = s.Content
+	stored.Language = s.Language
+	stored.LanguageConfidence = s.LanguageConfidence
+	stored.ContentType = s.ContentType
+	stored.Tags = sortedTags(s.Tags)
+	if expires != models.KeepExpiry {
+		stored.Expires = models.ExpiryTime(models.Now(), expires)
+	}
+
+	m.db.addRevision(stored)
+	m.db.index.Add(stored.ID, stored.Title, stored.Content)
+
+	return nil
+}
+
+// addRevision records the current title & content of s as its next version
+func (db *DB) addRevision(s *models.Snippet) {
+	revisions := db.revisions[s.ID]
+	version := 1
+	if len(revisions) > 0 {
+		version = revisions[len(revisions)-1].Version + 1
+	}
+	db.revisions[s.ID] = append(revisions, &models.Revision{
+		ID:        db.nextID(),
+		SnippetID: s.ID,
+		Version:   version,
+		Title:     s.Title,
+		Content:   s.Content,
+		Created:   models.Now(),
+	})
+}
+
+// sortedTags returns a copy of tags sorted by name, the order the SQL
+// stores return them in
+func sortedTags(tags []string) []string {
+	sorted := slices.Clone(tags)
+	slices.Sort(sorted)
+	return sorted
+}
+
+func (m *SnippetStore) Delete(ctx context.Context, id int) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if _, ok := m.db.snippets[id]; !ok {
+		return models.ErrNoRecord
+	}
+
+	delete(m.db.snippets, id)
+	delete(m.db.revisions, id)
+	m.db.index.Remove(id)
+
+	return nil
+}
+
+func (m *SnippetStore) PurgeExpired(ctx context.Context, before time.Time, limit int) (int, error) {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	// the snippets which expired first go first, like the SQL stores, the
+	// ID breaking the ties
+	expired := []*models.Snippet{}
+	for _, s := range m.db.snippets {
+		if s.Expires.Before(before) {
+			expired = append(expired, s)
+		}
+	}
+	slices.SortFunc(expired, func(a, b *models.Snippet) int {
+		if c := a.Expires.Compare(b.Expires); c != 0 {
+			return c
+		}
+		return a.ID - b.ID
+	})
+	expired = expired[:min(limit, len(expired))]
+
+	for _, s := range expired {
+		delete(m.db.snippets, s.ID)
+		delete(m.db.revisions, s.ID)
+		m.db.index.Remove(s.ID)
+	}
+
+	return len(expired), nil
+}
+
+func (m *SnippetStore) Get(ctx context.Context, id int) (*models.Snippet, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	s, ok := m.db.snippets[id]
+	if !ok || !live(s) {
+		return nil, models.ErrNoRecord
+	}
+
+	return m.db.copySnippet(s), nil
+}
+
+func (m *SnippetStore) GetIncludingExpired(ctx context.Context, id int) (*models.Snippet, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	s, ok := m.db.snippets[id]
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+
+	return m.db.copySnippet(s), nil
+}
+
+func (m *SnippetStore) Page(ctx context.Context, f models.PageFilter) ([]*models.Snippet, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	matching := []*models.Snippet{}
+	for _, s := range m.db.snippets {
+		switch {
+		case !live(s):
+		case f.After > 0 && s.ID <= f.After:
+		case f.Before > 0 && s.ID >= f.Before:
+		case !hasTags(s, f.Tags):
+		default:
+			matching = append(matching, s)
+		}
+	}
+
+	// newest first, except when paging towards newer snippets where the
+	// ones closest to the cursor are kept, like the SQL stores do
+	slices.SortFunc(matching, func(a, b *models.Snippet) int { return b.ID - a.ID })
+	if f.After > 0 && len(matching) > f.Limit {
+		matching = matching[len(matching)-f.Limit:]
+	}
+	if len(matching) > f.Limit {
+		matching = matching[:f.Limit]
+	}
+
+	snippets := make([]*models.Snippet, len(matching))
+	for i, s := range matching {
+		snippets[i] = m.db.copySnippet(s)
+	}
+
+	return snippets, nil
+}
+
+// hasTags returns true if s has all the given tags
+func hasTags(s *models.Snippet, tags []string) bool {
+	for _, tag := range tags {
+		if !slices.Contains(s.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *SnippetStore) ByUser(ctx context.Context, userID int) ([]*models.Snippet, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	snippets := []*models.Snippet{}
+	for _, s := range m.db.snippets {
+		if s.UserID == userID {
+			snippets = append(snippets, m.db.copySnippet(s))
+		}
+	}
+	slices.SortFunc(snippets, func(a, b *models.Snippet) int { return b.ID - a.ID })
+
+	return snippets, nil
+}
+
+func (m *SnippetStore) Search(ctx context.Context, q search.Query, limit int) ([]*models.Snippet, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	snippets := []*models.Snippet{}
+	for _, hit := range m.db.index.Search(q) {
+		s, ok := m.db.snippets[hit.ID]
+		if !ok || !live(s) || !q.Match(s.Title+"\n"+s.Content) {
+			continue
+		}
+		snippets = append(snippets, m.db.copySnippet(s))
+		if len(snippets) == limit {
+			break
+		}
+	}
+
+	return snippets, nil
+}
+
+// RevisionStore implements models.RevisionStore
+type RevisionStore struct {
+	db *DB
+}
+
+func (m *RevisionStore) Get(ctx context.Context, snippetID, version int) (*models.Revision, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	for _, r := range m.db.revisions[snippetID] {
+		if r.Version == version {
+			c := *r
+			return &c, nil
+		}
+	}
+
+	return nil, models.ErrNoRecord
+}
+
+func (m *RevisionStore) ForSnippet(ctx context.Context, snippetID int) ([]*models.Revision, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	revisions := []*models.Revision{}
+	for _, r := range slices.Backward(m.db.revisions[snippetID]) {
+		c := *r
+		revisions = append(revisions, &c)
+	}
+
+	return revisions, nil
+}
+
+func (m *RevisionStore) Prune(ctx context.Context, snippetID int) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if revisions := m.db.revisions[snippetID]; len(revisions) > 1 {
+		m.db.revisions[snippetID] = revisions[len(revisions)-1:]
+	}
+
+	return nil
+}
+
+// UserStore implements models.UserStore. BcryptCost is the cost of the
+// password hashes, models.DefaultBcryptCost if zero.
+type UserStore struct {
+	db         *DB
+	BcryptCost int
+}
+
+func (m *UserStore) Insert(ctx context.Context, name, email, password string) error {
+	hashedPassword, err := models.HashPassword(password, m.BcryptCost)
+	if err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	// emails are compared as they are, like PostgreSQL and SQLite do: the
+	// callers normalize them
+	for _, u := range m.db.users {
+		if u.Email == email {
+			return models.ErrDuplicateEmail
+		}
+	}
+
+	u := &models.User{
+		ID:             m.db.nextID(),
+		Name:           name,
+		Email:          email,
+		HashedPassword: hashedPassword,
+		Created:        models.Now(),
+	}
+	m.db.users[u.ID] = u
+
+	return nil
+}
+
+func (m *UserStore) Authenticate(ctx context.Context, email, password string) (int, error) {
+	m.db.mu.RLock()
+	var user *models.User
+	for _, u := range m.db.users {
+		if u.Email == email {
+			user = u
+			break
+		}
+	}
+	m.db.mu.RUnlock()
+
+	if user == nil {
+		return 0, models.ErrInvalidCredentials
+	}
+
+	err := bcrypt.CompareHashAndPassword(user.HashedPassword, []byte(password))
+	if err != nil {
+		return 0, models.ErrInvalidCredentials
+	}
+
+	return user.ID, nil
+}
+
+func (m *UserStore) Exists(ctx context.Context, id int) (bool, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	_, ok := m.db.users[id]
+	return ok, nil
+}
+
+// TokenStore implements models.TokenStore
+type TokenStore struct {
+	db *DB
+}
+
+func (m *TokenStore) Insert(ctx context.Context, userID int, name string, scopes []string) (string, int, error) {
+	plaintext := models.GenerateToken()
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	t := &token{
+		Token: models.Token{
+			ID:      m.db.nextID(),
+			UserID:  userID,
+			Name:    name,
+			Scopes:  slices.Clone(scopes),
+			Created: models.Now(),
+		},
+		hash: models.HashToken(plaintext),
+	}
+	m.db.tokens[t.ID] = t
+
+	return plaintext, t.ID, nil
+}
+
+func (m *TokenStore) ForUser(ctx context.Context, userID int) ([]*models.Token, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	tokens := []*models.Token{}
+	for _, t := range m.db.tokens {
+		if t.UserID == userID {
+			c := t.Token
+			c.Scopes = slices.Clone(t.Scopes)
+			tokens = append(tokens, &c)
+		}
+	}
+	slices.SortFunc(tokens, func(a, b *models.Token) int { return b.ID - a.ID })
+
+	return tokens, nil
+}
+
+func (m *TokenStore) Authenticate(ctx context.Context, plaintext string) (*models.Token, error) {
+	if !models.ValidTokenFormat(plaintext) {
+		return nil, models.ErrInvalidCredentials
+	}
+	hash := models.HashToken(plaintext)
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	for _, t := range m.db.tokens {
+		if bytes.Equal(t.hash, hash) {
+			t.LastUsed = models.Now()
+			c := t.Token
+			c.Scopes = slices.Clone(t.Scopes)
+			return &c, nil
+		}
+	}
+
+	return nil, models.ErrInvalidCredentials
+}
+
+func (m *TokenStore) Revoke(ctx context.Context, userID, id int) error {
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	t, ok := m.db.tokens[id]
+	if !ok || t.UserID != userID {
+		return models.ErrNoRecord
+	}
+	delete(m.db.tokens, id)
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Revision is an immutable copy of a snippet's title and content, saved every
+// time the snippet is created or edited. Version numbers start at 1 and are
+// sequential for each snippet.
+type Revision struct {
+	ID        int
+	SnippetID int
+	Version   int
+	Title     string
+	Content   string
+	Created   time.Time
+}
+
+// RevisionModel wraps a sql.DB connection pool for reading snippet revisions.
+// Revisions are written by SnippetModel, in the same transaction as the
+// snippet change they record. Dialect is the SQL dialect of the database,
+// Timeout bounds the queries of each method, if not zero. TracerProvider
+// creates the spans of the methods, the global one if nil.
+type RevisionModel struct {
+	DB             *sql.DB
+	Dialect        *Dialect
+	Timeout        time.Duration
+	TracerProvider trace.TracerProvider
+}
+
+// Get returns a specific version of a snippet
+func (m *RevisionModel) Get(ctx context.Context, snippetID, version int) (r *Revision, err error) {
+	ctx, end := m.Dialect.startCall(ctx, m.TracerProvider, "RevisionModel.Get", "SELECT", m.Timeout)
+	defer func() { err = end(err) }()
+
+	stmt := `SELECT id, snippet_id, version, title, content, created FROM snippet_revisions
+	WHERE snippet_id = ? AND version = ?`
+
+	r = &Revision{}
+	err = m.DB.QueryRowContext(ctx, m.Dialect.rebind(stmt), snippetID, version).Scan(&r.ID, &r.SnippetID, &r.Version, &r.Title, &r.Content, &r.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// ForSnippet returns all the revisions of a snippet, newest first
+func (m *RevisionModel) ForSnippet(ctx context.Context, snippetID int) (revisions []*Revision, err error) {
+	ctx, end := m.Dialect.startCall(ctx, m.TracerProvider, "RevisionModel.ForSnippet", "SELECT", m.Timeout)
+	defer func() { err = end(err) }()
+
+	stmt := `SELECT id, snippet_id, version, title, content, created FROM snippet_revisions
+	WHERE snippet_id = ? ORDER BY version DESC`
+
+	rows, err := m.DB.QueryContext(ctx, m.Dialect.rebind(stmt), snippetID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	revisions = []*Revision{}
+
+	for rows.Next() {
+		r := &Revision{}
+		err = rows.Scan(&r.ID, &r.SnippetID, &r.Version, &r.Title, &r.Content, &r.Created)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// Prune deletes every revision of a snippet but the latest, which keeps its
+// version number
+func (m *RevisionModel) Prune(ctx context.Context, snippetID int) (err error) {
+	ctx, end := m.Dialect.startCall(ctx, m.TracerProvider, "RevisionModel.Prune", "DELETE", m.Timeout)
+	defer func() { err = end(err) }()
+
+	// MySQL doesn't allow a subquery on the table a DELETE deletes from, so
+	// the latest version is looked up first. Revisions saved in between
+	// have a greater version and are kept.
+	var latest sql.NullInt64
+	stmt := `SELECT MAX(version) FROM snippet_revisions WHERE snippet_id = ?`
+	err = m.DB.QueryRowContext(ctx, m.Dialect.rebind(stmt), snippetID).Scan(&latest)
+	if err != nil || !latest.Valid {
+		return err
+	}
+
+	stmt = `DELETE FROM snippet_revisions WHERE snippet_id = ? AND version < ?`
+	_, err = m.DB.ExecContext(ctx, m.Dialect.rebind(stmt), snippetID, latest.Int64)
+	return err
+}
+
+// insertRevision records the given title & content as the next version of a
+// snippet, created at the given time. It's meant to run in the transaction that changes the snippet.
+func insertRevision(ctx context.Context, tx *sql.Tx, dialect *Dialect, snippetID int, title, content string, created time.Time) error {
+	stmt := `INSERT INTO snippet_revisions (snippet_id, version, title, content, created)
+	SELECT ?, COALESCE(MAX(version), 0) + 1, ?, ?, ?
+	FROM snippet_revisions WHERE snippet_id = ?`
+
+	_, err := tx.ExecContext(ctx, dialect.rebind(stmt), snippetID, title, content, created, snippetID)
+	return err
+}
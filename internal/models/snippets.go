@@ -1,55 +1,309 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"slices"
+	"strings"
 	"time"
+
+	"snippetbox.cnoua.org/internal/search"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 // define a snippet type to hold the data for an individual snippet. The fields of the struct
-// correspond to the fields in our MySQL snippets table
+// correspond to the fields in our MySQL snippets table. LanguageConfidence is 1 when
+// the author picked the language, and lower when it was detected from the content.
+// ContentType tells how the content is displayed, one of the ContentType constants.
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	ID                 int
+	Title              string
+	Content            string
+	Created            time.Time
+	Expires            time.Time
+	Language           string
+	LanguageConfidence float64
+	ContentType        string
+	UserID             int
+	UserName           string
+	Tags               []string
 }
 
-// define a SnippetModel type which wraps a sql.DB connection pool
+// content types of snippets: plain text or code, shown as is with syntax
+// highlighting, or markdown rendered as HTML
+const (
+	ContentTypeText     = "text"
+	ContentTypeMarkdown = "markdown"
+)
+
+// Expired returns true if the snippet's expiry time has passed
+func (s *Snippet) Expired() bool {
+	return !s.Expires.After(time.Now())
+}
+
+// define a SnippetModel type which wraps a sql.DB connection pool. Index is
+// the full-text index used by Search, it's filled by BuildIndex and kept up
+// to date as snippets are created, changed and deleted through the model.
+// The changes made through the other instances of the application are picked
+// up by RefreshIndex. Dialect is the
+// SQL dialect of the database. Timeout bounds the queries of each method, if
+// not zero: they fail with ErrTimeout once it has passed. TracerProvider
+// creates the spans of the methods, the global one if nil.
 type SnippetModel struct {
-	DB *sql.DB
+	DB             *sql.DB
+	Dialect        *Dialect
+	Index          *search.Index
+	Timeout        time.Duration
+	TracerProvider trace.TracerProvider
 }
 
-// insert a new snippet into the database
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
-	stmt := `INSERT INTO snippets (title, content, created, expires)
-	VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
-	// execute the statement
-	result, err := m.DB.Exec(stmt, title, content, expires)
+// insert a new snippet into the database and record its first revision. The
+// title, content, language, content type, owner (UserID) and tags are taken
+// from s, which expires in the given number of days.
+func (m *SnippetModel) Insert(ctx context.Context, s *Snippet, expires int) (id int, err error) {
+	ctx, end := m.Dialect.startCall(ctx, m.TracerProvider, "SnippetModel.Insert", "INSERT", m.Timeout)
+	defer func() { err = end(err) }()
+
+	// the snippet and its revision are written in a single transaction, so
+	// that a snippet never exists without its history. Rollback() is a no-op
+	// once the transaction has been committed.
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return 0, err
 	}
-	// use the LastInsertId() method on the result to get the ID of the newly inserted record
-	id, err := result.LastInsertId()
+	defer tx.Rollback()
+
+	stmt := `INSERT INTO snippets (title, content, language, language_confidence, content_type, created, expires, user_id)
+	VALUES(?, ?, ?, ?, ?, ?, ?, ?)`
+	// execute the statement and get the ID of the newly inserted record
+	created := Now()
+	id, err = m.Dialect.insert(ctx, tx, stmt, s.Title, s.Content, s.Language, s.LanguageConfidence, s.ContentType,
+		created, ExpiryTime(created, expires), s.UserID)
 	if err != nil {
 		return 0, err
 	}
-	// the ID returned has the type int64, so we convert it to an int before returning
-	return int(id), nil
+
+	err = insertRevision(ctx, tx, m.Dialect, id, s.Title, s.Content, created)
+	if err != nil {
+		return 0, err
+	}
+
+	err = setTags(ctx, tx, m.Dialect, id, s.Tags)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	if m.Index != nil {
+		m.Index.Add(id, s.Title, s.Content)
+	}
+
+	return id, nil
+}
+
+// Update replaces the title, content, language, content type & tags of the existing snippet
+// identified by s.ID, resets its expiry to the given number of days from now,
+// or keeps it if expires is KeepExpiry, and records the change as a new revision
+func (m *SnippetModel) Update(ctx context.Context, s *Snippet, expires int) (err error) {
+	ctx, end := m.Dialect.startCall(ctx, m.TracerProvider, "SnippetModel.Update", "UPDATE", m.Timeout)
+	defer func() { err = end(err) }()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	updated := Now()
+	stmt := `UPDATE snippets SET title = ?, content = ?, language = ?, language_confidence = ?, content_type = ?`
+	args := []any{s.Title, s.Content, s.Language, s.LanguageConfidence, s.ContentType}
+	if expires != KeepExpiry {
+		stmt += `, expires = ?`
+		args = append(args, ExpiryTime(updated, expires))
+	}
+	stmt += ` WHERE id = ?`
+	args = append(args, s.ID)
+
+	// MySQL doesn't count rows whose values didn't change as affected, so the
+	// caller is expected to have checked that the snippet exists beforehand
+	_, err = tx.ExecContext(ctx, m.Dialect.rebind(stmt), args...)
+	if err != nil {
+		return err
+	}
+
+	err = insertRevision(ctx, tx, m.Dialect, s.ID, s.Title, s.Content, updated)
+	if err != nil {
+		return err
+	}
+
+	err = setTags(ctx, tx, m.Dialect, s.ID, s.Tags)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	if m.Index != nil {
+		m.Index.Add(s.ID, s.Title, s.Content)
+	}
+
+	return nil
+}
+
+// Delete removes a snippet and its revisions from the database
+func (m *SnippetModel) Delete(ctx context.Context, id int) (err error) {
+	ctx, end := m.Dialect.startCall(ctx, m.TracerProvider, "SnippetModel.Delete", "DELETE", m.Timeout)
+	defer func() { err = end(err) }()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, m.Dialect.rebind(`DELETE FROM snippet_revisions WHERE snippet_id = ?`), id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, m.Dialect.rebind(`DELETE FROM snippet_tags WHERE snippet_id = ?`), id)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, m.Dialect.rebind(`DELETE FROM snippets WHERE id = ?`), id)
+	if err != nil {
+		return err
+	}
+
+	if err = checkRowsAffected(result); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	if m.Index != nil {
+		m.Index.Remove(id)
+	}
+
+	return nil
+}
+
+// PurgeExpired deletes up to limit snippets which expired before the given
+// time, along with their revisions & tags, and returns how many were deleted.
+// Deleting in bounded batches keeps the transactions, and the locks they
+// hold, short.
+func (m *SnippetModel) PurgeExpired(ctx context.Context, before time.Time, limit int) (n int, err error) {
+	ctx, end := m.Dialect.startCall(ctx, m.TracerProvider, "SnippetModel.PurgeExpired", "DELETE", m.Timeout)
+	defer func() { err = end(err) }()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// the oldest snippets go first, walking the index on expires rather than
+	// sorting every expired snippet
+	stmt := `SELECT id FROM snippets WHERE expires < ? ORDER BY expires LIMIT ?`
+
+	rows, err := tx.QueryContext(ctx, m.Dialect.rebind(stmt), before, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	ids := []any{}
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	in := `(?` + strings.Repeat(", ?", len(ids)-1) + `)`
+	for _, table := range []string{"snippet_revisions", "snippet_tags"} {
+		_, err = tx.ExecContext(ctx, m.Dialect.rebind(`DELETE FROM `+table+` WHERE snippet_id IN `+in), ids...)
+		if err != nil {
+			return 0, err
+		}
+	}
+	_, err = tx.ExecContext(ctx, m.Dialect.rebind(`DELETE FROM snippets WHERE id IN `+in), ids...)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	// expired snippets are already left out of search results, this only
+	// frees the memory they use
+	if m.Index != nil {
+		for _, id := range ids {
+			m.Index.Remove(id.(int))
+		}
+	}
+
+	return len(ids), nil
 }
 
 // return a specific snippet based on its id
-func (m *SnippetModel) Get(id int) (*Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-	WHERE expires > UTC_TIMESTAMP() AND id = ?`
+func (m *SnippetModel) Get(ctx context.Context, id int) (s *Snippet, err error) {
+	ctx, end := m.Dialect.startCall(ctx, m.TracerProvider, "SnippetModel.Get", "SELECT", m.Timeout)
+	defer func() { err = end(err) }()
+
+	return m.get(ctx, id, true)
+}
+
+// GetIncludingExpired works like Get, but also returns a snippet whose expiry
+// time has passed, for its author to edit or delete it until it's purged
+func (m *SnippetModel) GetIncludingExpired(ctx context.Context, id int) (s *Snippet, err error) {
+	ctx, end := m.Dialect.startCall(ctx, m.TracerProvider, "SnippetModel.GetIncludingExpired", "SELECT", m.Timeout)
+	defer func() { err = end(err) }()
+
+	return m.get(ctx, id, false)
+}
+
+// get returns the snippet identified by id, only if it hasn't expired when
+// live is set
+func (m *SnippetModel) get(ctx context.Context, id int, live bool) (*Snippet, error) {
+	// left join on users so that snippets created before ownership was recorded
+	// are still returned, with an empty author name
+	stmt := `SELECT s.id, s.title, s.content, s.language, s.language_confidence, s.content_type, s.created, s.expires,
+	COALESCE(s.user_id, 0), COALESCE(u.name, '') FROM snippets s
+	LEFT JOIN users u ON u.id = s.user_id
+	WHERE s.id = ?`
+	args := []any{id}
+	if live {
+		stmt += ` AND s.expires > ?`
+		args = append(args, Now())
+	}
 	// use QueryRow() to execute SQL statement, this returns a pointer to a sql.Row object
-	row := m.DB.QueryRow(stmt, id)
+	row := m.DB.QueryRowContext(ctx, m.Dialect.rebind(stmt), args...)
 	// initialize a pointer to a new zeroed Snippet struct
 	s := &Snippet{}
 	// use row.Scan() to copy the values from each field in sql.Row to the corresponding
 	// field in Snippet struct.
-	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Language, &s.LanguageConfidence, &s.ContentType, &s.Created, &s.Expires, &s.UserID, &s.UserName)
 	if err != nil {
 		// if query returns no rows, then row.Scan() will return a
 		// sql.ErrNoRows error. We use errors.Is() fn to check and return
@@ -60,16 +314,256 @@ func (m *SnippetModel) Get(id int) (*Snippet, error) {
 			return nil, err
 		}
 	}
-	// if everything went ok, return Snippet object
+	// if everything went ok, add the tags and return Snippet object
+	err = m.attachTags(ctx, []*Snippet{s})
+	if err != nil {
+		return nil, err
+	}
+
 	return s, nil
 }
 
-// return the 10 most recently created snippets
-func (m *SnippetModel) Latest() ([]*Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-	WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT 10`
+// PageFilter selects a page of snippets for keyset pagination on the id
+// column. At most one of Before and After should be set.
+type PageFilter struct {
+	// only return snippets with an id lower than Before, if not zero
+	Before int
+	// only return snippets with an id higher than After, if not zero
+	After int
+	// maximum number of snippets to return
+	Limit int
+	// only return snippets having all these tags, if any
+	Tags []string
+}
+
+// Page returns a page of live snippets, newest first. Paging on the id rather
+// than using an OFFSET keeps queries fast however deep the page is, and
+// stable while new snippets are being created.
+func (m *SnippetModel) Page(ctx context.Context, f PageFilter) (snippets []*Snippet, err error) {
+	ctx, end := m.Dialect.startCall(ctx, m.TracerProvider, "SnippetModel.Page", "SELECT", m.Timeout)
+	defer func() { err = end(err) }()
+
+	where := []string{"expires > ?"}
+	args := []any{Now()}
+
+	// when paging towards newer snippets, we need the ones closest to the
+	// cursor, so the query sorts in ascending order and the result is
+	// reversed afterwards
+	order := "DESC"
+	switch {
+	case f.After > 0:
+		where = append(where, "id > ?")
+		args = append(args, f.After)
+		order = "ASC"
+	case f.Before > 0:
+		where = append(where, "id < ?")
+		args = append(args, f.Before)
+	}
+
+	if len(f.Tags) > 0 {
+		clause, tagArgs := taggedClause(f.Tags)
+		where = append(where, clause)
+		args = append(args, tagArgs...)
+	}
+
+	stmt := `SELECT id, title, content, language, language_confidence, content_type, created, expires FROM snippets
+	WHERE ` + strings.Join(where, " AND ") + ` ORDER BY id ` + order + ` LIMIT ?`
+	args = append(args, f.Limit)
+
+	snippets, err = m.query(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.After > 0 {
+		slices.Reverse(snippets)
+	}
+
+	if err = m.attachTags(ctx, snippets); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// ByUser returns all the snippets created by the given user, including the
+// expired ones, newest first
+func (m *SnippetModel) ByUser(ctx context.Context, userID int) (snippets []*Snippet, err error) {
+	ctx, end := m.Dialect.startCall(ctx, m.TracerProvider, "SnippetModel.ByUser", "SELECT", m.Timeout)
+	defer func() { err = end(err) }()
+
+	stmt := `SELECT s.id, s.title, s.content, s.language, s.language_confidence, s.content_type, s.created, s.expires, s.user_id, u.name
+	FROM snippets s INNER JOIN users u ON u.id = s.user_id
+	WHERE s.user_id = ? ORDER BY s.id DESC`
+
+	rows, err := m.DB.QueryContext(ctx, m.Dialect.rebind(stmt), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	snippets = []*Snippet{}
+
+	for rows.Next() {
+		s := &Snippet{}
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Language, &s.LanguageConfidence, &s.ContentType, &s.Created, &s.Expires, &s.UserID, &s.UserName)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err = m.attachTags(ctx, snippets); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// checkRowsAffected returns ErrNoRecord if a statement didn't change any row
+func checkRowsAffected(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// BuildIndex adds every live snippet to the search index
+func (m *SnippetModel) BuildIndex(ctx context.Context) (err error) {
+	ctx, end := m.Dialect.startCall(ctx, m.TracerProvider, "SnippetModel.BuildIndex", "SELECT", m.Timeout)
+	defer func() { err = end(err) }()
+
+	stmt := `SELECT id, title, content FROM snippets WHERE expires > ?`
+
+	rows, err := m.DB.QueryContext(ctx, m.Dialect.rebind(stmt), Now())
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var title, content string
+		if err = rows.Scan(&id, &title, &content); err != nil {
+			return err
+		}
+		m.Index.Add(id, title, content)
+	}
+
+	return rows.Err()
+}
+
+// RefreshIndex adds to the search index the live snippets created or changed
+// since the given time, whichever instance of the application saved them,
+// and returns their number. Every change records a revision, so they're
+// looked up by the time of their revisions. Deleted and expired snippets are
+// dropped from the index by Search, once found to be gone.
+func (m *SnippetModel) RefreshIndex(ctx context.Context, since time.Time) (n int, err error) {
+	ctx, end := m.Dialect.startCall(ctx, m.TracerProvider, "SnippetModel.RefreshIndex", "SELECT", m.Timeout)
+	defer func() { err = end(err) }()
+
+	stmt := `SELECT id, title, content FROM snippets
+	WHERE expires > ? AND id IN (SELECT snippet_id FROM snippet_revisions WHERE created >= ?)`
+
+	rows, err := m.DB.QueryContext(ctx, m.Dialect.rebind(stmt), Now(), since)
+	if err != nil {
+		return 0, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var title, content string
+		if err = rows.Scan(&id, &title, &content); err != nil {
+			return 0, err
+		}
+		m.Index.Add(id, title, content)
+		n++
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// Search returns up to limit live snippets matching the query, the most
+// relevant first. Candidates are looked up in the search index, then checked
+// against their current content for phrases & exclusions.
+func (m *SnippetModel) Search(ctx context.Context, q search.Query, limit int) (snippets []*Snippet, err error) {
+	ctx, end := m.Dialect.startCall(ctx, m.TracerProvider, "SnippetModel.Search", "SELECT", m.Timeout)
+	defer func() { err = end(err) }()
+
+	hits := m.Index.Search(q)
+
+	snippets = []*Snippet{}
+
+	// fetch the candidates in batches, until we have enough matching snippets
+	const batchSize = 100
+	for start := 0; start < len(hits) && len(snippets) < limit; start += batchSize {
+		batch := hits[start:min(start+batchSize, len(hits))]
+
+		args := make([]any, 0, len(batch)+1)
+		args = append(args, Now())
+		for _, hit := range batch {
+			args = append(args, hit.ID)
+		}
+
+		stmt := `SELECT id, title, content, language, language_confidence, content_type, created, expires FROM snippets
+		WHERE expires > ? AND id IN (?` + strings.Repeat(", ?", len(batch)-1) + `)`
+
+		found, err := m.query(ctx, stmt, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		// put the snippets back in ranking order
+		byID := make(map[int]*Snippet, len(found))
+		for _, s := range found {
+			byID[s.ID] = s
+		}
+		for _, hit := range batch {
+			s, ok := byID[hit.ID]
+			if !ok {
+				// deleted or expired, maybe by another instance
+				m.Index.Remove(hit.ID)
+				continue
+			}
+			if !q.Match(s.Title + "\n" + s.Content) {
+				continue
+			}
+			snippets = append(snippets, s)
+			if len(snippets) == limit {
+				break
+			}
+		}
+	}
+
+	if err = m.attachTags(ctx, snippets); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// query runs a statement selecting the id, title, content, language,
+// language_confidence, content_type, created and expires columns of snippets
+// and returns the resulting snippets
+func (m *SnippetModel) query(ctx context.Context, stmt string, args ...any) ([]*Snippet, error) {
 	// connect to pool and execute stmt, this returns a sql.Rows result set
-	rows, err := m.DB.Query(stmt)
+	rows, err := m.DB.QueryContext(ctx, m.Dialect.rebind(stmt), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -87,7 +581,7 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 		s := &Snippet{}
 		// use rows.Scan() to copy the values from each field in the row to the new
 		// Snippet object created
-		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Language, &s.LanguageConfidence, &s.ContentType, &s.Created, &s.Expires)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,393 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"snippetbox.cnoua.org/internal/migrations"
+	"snippetbox.cnoua.org/internal/search"
+
+	_ "modernc.org/sqlite"
+)
+
+// newTestSQLiteDB returns an empty in-memory SQLite database with our schema
+func newTestSQLiteDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", "file::memory:?_pragma=foreign_keys(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection to :memory: opens a new database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrations.New(db, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// insertTestUser adds a user to db and returns its ID
+func insertTestUser(t *testing.T, db *sql.DB, email string) int {
+	t.Helper()
+
+	m := &UserModel{DB: db, Dialect: SQLite}
+	if err := m.Insert(t.Context(), "Test", email, "pa$$word"); err != nil {
+		t.Fatal(err)
+	}
+	id, err := m.Authenticate(t.Context(), email, "pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestSQLiteUsers(t *testing.T) {
+	m := &UserModel{DB: newTestSQLiteDB(t), Dialect: SQLite}
+
+	err := m.Insert(t.Context(), "Alice", "alice@example.com", "pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Insert(t.Context(), "Alice", "alice@example.com", "pa$$word")
+	if !errors.Is(err, ErrDuplicateEmail) {
+		t.Errorf("got error %v; want %v", err, ErrDuplicateEmail)
+	}
+
+	id, err := m.Authenticate(t.Context(), "alice@example.com", "pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exists, err := m.Exists(t.Context(), id)
+	if err != nil || !exists {
+		t.Errorf("got %t, %v; want user %d to exist", exists, err, id)
+	}
+
+	_, err = m.Authenticate(t.Context(), "alice@example.com", "wrong")
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("got error %v; want %v", err, ErrInvalidCredentials)
+	}
+}
+
+func TestSQLiteSnippets(t *testing.T) {
+	db := newTestSQLiteDB(t)
+	m := &SnippetModel{DB: db, Dialect: SQLite, Index: search.NewIndex()}
+	userID := insertTestUser(t, db, "alice@example.com")
+
+	id, err := m.Insert(t.Context(), &Snippet{Title: "Hello", Content: "hello world", ContentType: ContentTypeText, UserID: userID, Tags: []string{"b", "a"}}, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiredID, err := m.Insert(t.Context(), &Snippet{Title: "Gone", Content: "hello again", ContentType: ContentTypeText, UserID: userID}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := m.Get(t.Context(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Title != "Hello" || s.UserName != "Test" || !slices.Equal(s.Tags, []string{"a", "b"}) {
+		t.Errorf("got %+v", s)
+	}
+	if days := s.Expires.Sub(s.Created).Hours() / 24; days != 7 {
+		t.Errorf("got an expiry in %v days; want 7", days)
+	}
+
+	_, err = m.Get(t.Context(), expiredID)
+	if !errors.Is(err, ErrNoRecord) {
+		t.Errorf("got error %v for an expired snippet; want %v", err, ErrNoRecord)
+	}
+
+	s.Content = "hello there"
+	s.Tags = []string{"a"}
+	if err = m.Update(t.Context(), s, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := m.Page(t.Context(), PageFilter{Limit: 10, Tags: []string{"a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 1 || page[0].Content != "hello there" {
+		t.Errorf("got page %+v", page)
+	}
+
+	found, err := m.Search(t.Context(), search.Parse("hello"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].ID != id {
+		t.Errorf("got search results %+v", found)
+	}
+
+	rm := &RevisionModel{DB: db, Dialect: SQLite}
+	revisions, err := rm.ForSnippet(t.Context(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 || revisions[0].Version != 2 || revisions[0].Content != "hello there" {
+		t.Errorf("got revisions %+v", revisions)
+	}
+
+	// pruning keeps the latest revision, and the next one follows it
+	if err = rm.Prune(t.Context(), id); err != nil {
+		t.Fatal(err)
+	}
+	s.Content = "hello again"
+	if err = m.Update(t.Context(), s, 1); err != nil {
+		t.Fatal(err)
+	}
+	revisions, err = rm.ForSnippet(t.Context(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 || revisions[0].Version != 3 || revisions[1].Version != 2 {
+		t.Errorf("got revisions %+v after pruning", revisions)
+	}
+
+	if err = m.Delete(t.Context(), id); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Delete(t.Context(), id); !errors.Is(err, ErrNoRecord) {
+		t.Errorf("got error %v deleting twice; want %v", err, ErrNoRecord)
+	}
+}
+
+// TestSQLiteRefreshIndex checks that an instance picks up the snippets
+// changed through another one, which has a search index of its own
+func TestSQLiteRefreshIndex(t *testing.T) {
+	db := newTestSQLiteDB(t)
+	writer := &SnippetModel{DB: db, Dialect: SQLite, Index: search.NewIndex()}
+	reader := &SnippetModel{DB: db, Dialect: SQLite, Index: search.NewIndex()}
+	userID := insertTestUser(t, db, "alice@example.com")
+
+	since := Now()
+	if err := reader.BuildIndex(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := writer.Insert(t.Context(), &Snippet{Title: "Greeting", Content: "hello world", ContentType: ContentTypeText, UserID: userID}, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = writer.Insert(t.Context(), &Snippet{Title: "Gone", Content: "hello again", ContentType: ContentTypeText, UserID: userID}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	find := func(query string) []int {
+		t.Helper()
+		found, err := reader.Search(t.Context(), search.Parse(query), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int
+		for _, s := range found {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+
+	if ids := find("hello"); len(ids) != 0 {
+		t.Errorf("got %v before refreshing; want no results", ids)
+	}
+
+	refresh := func(want int) {
+		t.Helper()
+		n, err := reader.RefreshIndex(t.Context(), since)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Errorf("got %d snippets refreshed; want %d", n, want)
+		}
+	}
+
+	// the expired snippet is left out
+	refresh(1)
+	if ids := find("hello"); !slices.Equal(ids, []int{id}) {
+		t.Errorf("got %v after an insert; want [%d]", ids, id)
+	}
+
+	s, err := writer.Get(t.Context(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Content = "goodbye world"
+	if err = writer.Update(t.Context(), s, KeepExpiry); err != nil {
+		t.Fatal(err)
+	}
+	refresh(1)
+	if ids := find("hello"); len(ids) != 0 {
+		t.Errorf("got %v for the old content after an update; want no results", ids)
+	}
+	if ids := find("goodbye"); !slices.Equal(ids, []int{id}) {
+		t.Errorf("got %v for the new content after an update; want [%d]", ids, id)
+	}
+
+	// deleted snippets are dropped from the index by the searches finding
+	// them
+	if err = writer.Delete(t.Context(), id); err != nil {
+		t.Fatal(err)
+	}
+	if ids := find("goodbye"); len(ids) != 0 {
+		t.Errorf("got %v after a delete; want no results", ids)
+	}
+	if n := reader.Index.Len(); n != 0 {
+		t.Errorf("got %d snippets left in the index; want 0", n)
+	}
+}
+
+func TestSQLiteRevisionsBackfill(t *testing.T) {
+	db, err := sql.Open("sqlite", "file::memory:?_pragma=foreign_keys(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	// a snippet saved before revisions were recorded
+	for _, stmt := range []string{
+		`CREATE TABLE snippets (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			title TEXT NOT NULL,
+			content TEXT NOT NULL,
+			created DATETIME NOT NULL,
+			expires DATETIME NOT NULL
+		)`,
+		`INSERT INTO snippets (title, content, created, expires) VALUES ('Hello', 'hello world', '2024-01-01 00:00:00', '2034-01-01 00:00:00')`,
+	} {
+		if _, err = db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	migrator, err := migrations.New(db, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &SnippetModel{DB: db, Dialect: SQLite}
+	s, err := m.Get(t.Context(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Content = "hello there"
+	if err = m.Update(t.Context(), s, KeepExpiry); err != nil {
+		t.Fatal(err)
+	}
+
+	rm := &RevisionModel{DB: db, Dialect: SQLite}
+	r, err := rm.Get(t.Context(), s.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Content != "hello world" || !r.Created.Equal(s.Created) {
+		t.Errorf("got version 1 %+v; want the content before the edit", r)
+	}
+	r, err = rm.Get(t.Context(), s.ID, 2)
+	if err != nil || r.Content != "hello there" {
+		t.Errorf("got version 2 %+v, %v; want the edited content", r, err)
+	}
+}
+
+func TestSQLiteTokens(t *testing.T) {
+	db := newTestSQLiteDB(t)
+	m := &TokenModel{DB: db, Dialect: SQLite}
+	userID := insertTestUser(t, db, "alice@example.com")
+
+	plaintext, id, err := m.Insert(t.Context(), userID, "ci", []string{ScopeRead, ScopeWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := m.Authenticate(t.Context(), plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.ID != id || !token.HasScope(ScopeWrite) || token.HasScope(ScopeDelete) {
+		t.Errorf("got %+v", token)
+	}
+
+	tokens, err := m.ForUser(t.Context(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].LastUsed.IsZero() {
+		t.Errorf("got %+v", tokens)
+	}
+
+	if err = m.Revoke(t.Context(), userID+1, id); !errors.Is(err, ErrNoRecord) {
+		t.Errorf("got error %v revoking another user's token; want %v", err, ErrNoRecord)
+	}
+	if err = m.Revoke(t.Context(), userID, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Authenticate(t.Context(), plaintext); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("got error %v for a revoked token; want %v", err, ErrInvalidCredentials)
+	}
+}
+
+func TestSQLitePurgeExpired(t *testing.T) {
+	db := newTestSQLiteDB(t)
+	m := &SnippetModel{DB: db, Dialect: SQLite, Index: search.NewIndex()}
+	userID := insertTestUser(t, db, "alice@example.com")
+
+	for _, expires := range []int{-3, -2, -1, 7} {
+		_, err := m.Insert(t.Context(), &Snippet{Title: "Hello", Content: "hello", ContentType: ContentTypeText, UserID: userID, Tags: []string{"a"}}, expires)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// only the snippets expired for more than a day and a half, in batches
+	before := Now().Add(-36 * time.Hour)
+	for _, want := range []int{1, 1, 0} {
+		n, err := m.PurgeExpired(t.Context(), before, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Errorf("purged %d snippets; want %d", n, want)
+		}
+	}
+
+	var snippets, revisions, tags int
+	err := db.QueryRow(`SELECT (SELECT COUNT(*) FROM snippets), (SELECT COUNT(*) FROM snippet_revisions),
+	(SELECT COUNT(*) FROM snippet_tags)`).Scan(&snippets, &revisions, &tags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snippets != 2 || revisions != 2 || tags != 2 {
+		t.Errorf("got %d snippets, %d revisions & %d tags left; want 2 of each", snippets, revisions, tags)
+	}
+}
+
+func TestSQLitePurgeExpiredUsesIndex(t *testing.T) {
+	db := newTestSQLiteDB(t)
+
+	var id, parent, notUsed int
+	var detail string
+	err := db.QueryRow(`EXPLAIN QUERY PLAN SELECT id FROM snippets WHERE expires < ? ORDER BY expires LIMIT ?`, Now(), 10).
+		Scan(&id, &parent, &notUsed, &detail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(detail, "idx_snippets_expires") {
+		t.Errorf("got query plan %q; want the expired snippets looked up by index", detail)
+	}
+}
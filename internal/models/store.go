@@ -0,0 +1,72 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"snippetbox.cnoua.org/internal/search"
+)
+
+// SnippetStore is implemented by the storage backends of snippets. Snippets
+// whose expiry time has passed are only returned by ByUser and
+// GetIncludingExpired, until they're deleted by PurgeExpired.
+type SnippetStore interface {
+	Insert(ctx context.Context, s *Snippet, expires int) (int, error)
+	Update(ctx context.Context, s *Snippet, expires int) error
+	Delete(ctx context.Context, id int) error
+	Get(ctx context.Context, id int) (*Snippet, error)
+	GetIncludingExpired(ctx context.Context, id int) (*Snippet, error)
+	Page(ctx context.Context, f PageFilter) ([]*Snippet, error)
+	ByUser(ctx context.Context, userID int) ([]*Snippet, error)
+	Search(ctx context.Context, q search.Query, limit int) ([]*Snippet, error)
+	PurgeExpired(ctx context.Context, before time.Time, limit int) (int, error)
+}
+
+// RevisionStore is implemented by the storage backends of snippet revisions
+type RevisionStore interface {
+	Get(ctx context.Context, snippetID, version int) (*Revision, error)
+	ForSnippet(ctx context.Context, snippetID int) ([]*Revision, error)
+	Prune(ctx context.Context, snippetID int) error
+}
+
+// UserStore is implemented by the storage backends of users. Emails are
+// compared as they are, case sensitively except on MySQL, so they're expected
+// to be normalized by the callers.
+type UserStore interface {
+	Insert(ctx context.Context, name, email, password string) error
+	Authenticate(ctx context.Context, email, password string) (int, error)
+	Exists(ctx context.Context, id int) (bool, error)
+}
+
+// TokenStore is implemented by the storage backends of API tokens
+type TokenStore interface {
+	Insert(ctx context.Context, userID int, name string, scopes []string) (string, int, error)
+	ForUser(ctx context.Context, userID int) ([]*Token, error)
+	Authenticate(ctx context.Context, plaintext string) (*Token, error)
+	Revoke(ctx context.Context, userID, id int) error
+}
+
+// check at compile time that the SQL models implement the store interfaces
+var (
+	_ SnippetStore  = (*SnippetModel)(nil)
+	_ RevisionStore = (*RevisionModel)(nil)
+	_ UserStore     = (*UserModel)(nil)
+	_ TokenStore    = (*TokenModel)(nil)
+)
+
+// Now returns the current time as stored with records: in UTC, to the second.
+// Timestamps are computed in Go rather than by the database, as each
+// database has its own date functions.
+func Now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// KeepExpiry is the number of days passed to SnippetStore.Update to keep the
+// expiry time of a snippet as it is
+const KeepExpiry = 0
+
+// ExpiryTime returns the expiry time of a snippet created or updated at
+// time t, which expires in the given number of days
+func ExpiryTime(t time.Time, days int) time.Time {
+	return t.AddDate(0, 0, days)
+}
@@ -0,0 +1,227 @@
+package models_test
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"snippetbox.cnoua.org/internal/migrations"
+	"snippetbox.cnoua.org/internal/models"
+	"snippetbox.cnoua.org/internal/models/memory"
+	"snippetbox.cnoua.org/internal/search"
+
+	_ "modernc.org/sqlite"
+)
+
+// backendStores holds the stores of a backend, sharing the same database
+type backendStores struct {
+	users    models.UserStore
+	snippets models.SnippetStore
+}
+
+// newStores returns the empty stores of each backend which can run in tests,
+// so that they can be checked to behave the same
+func newStores(t *testing.T) map[string]backendStores {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", "file::memory:?_pragma=foreign_keys(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection to :memory: opens a new database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrations.New(db, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	mem := memory.New()
+	users := mem.Users()
+	users.BcryptCost = bcrypt.MinCost
+
+	return map[string]backendStores{
+		"memory": {users, mem.Snippets()},
+		"sqlite": {
+			&models.UserModel{DB: db, Dialect: models.SQLite, BcryptCost: bcrypt.MinCost},
+			&models.SnippetModel{DB: db, Dialect: models.SQLite, Index: search.NewIndex()},
+		},
+	}
+}
+
+func TestUserStores(t *testing.T) {
+	for name, stores := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			users := stores.users
+
+			err := users.Insert(t.Context(), "Alice", "alice@example.com", "pa$$word")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = users.Insert(t.Context(), "Alice", "alice@example.com", "other pa$$word")
+			if !errors.Is(err, models.ErrDuplicateEmail) {
+				t.Errorf("got error %v inserting a duplicate email; want %v", err, models.ErrDuplicateEmail)
+			}
+
+			id, err := users.Authenticate(t.Context(), "alice@example.com", "pa$$word")
+			if err != nil {
+				t.Fatal(err)
+			}
+			exists, err := users.Exists(t.Context(), id)
+			if err != nil || !exists {
+				t.Errorf("got %t, %v; want user %d to exist", exists, err, id)
+			}
+
+			tests := []struct {
+				name     string
+				email    string
+				password string
+			}{
+				{"Wrong password", "alice@example.com", "wrong"},
+				{"Password of the duplicate", "alice@example.com", "other pa$$word"},
+				{"Unknown email", "bob@example.com", "pa$$word"},
+				// emails are compared as they are, the callers normalize them
+				{"Email in another case", "Alice@Example.com", "pa$$word"},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					_, err := users.Authenticate(t.Context(), tt.email, tt.password)
+					if !errors.Is(err, models.ErrInvalidCredentials) {
+						t.Errorf("got error %v; want %v", err, models.ErrInvalidCredentials)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestSnippetPages(t *testing.T) {
+	for name, stores := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			err := stores.users.Insert(t.Context(), "Alice", "alice@example.com", "pa$$word")
+			if err != nil {
+				t.Fatal(err)
+			}
+			userID, err := stores.users.Authenticate(t.Context(), "alice@example.com", "pa$$word")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// snippets 1 to 6, the fourth one expired and the odd ones tagged
+			var ids []int
+			for i := 1; i <= 6; i++ {
+				s := &models.Snippet{Title: "Hello", Content: "hello", ContentType: models.ContentTypeText, UserID: userID}
+				if i%2 == 1 {
+					s.Tags = []string{"odd"}
+				}
+				expires := 7
+				if i == 4 {
+					expires = -1
+				}
+				id, err := stores.snippets.Insert(t.Context(), s, expires)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids = append(ids, id)
+			}
+			// snippet returns the ID of the nth snippet
+			snippet := func(n int) int { return ids[n-1] }
+
+			tests := []struct {
+				name   string
+				filter models.PageFilter
+				want   []int
+			}{
+				{"First page", models.PageFilter{Limit: 2}, []int{6, 5}},
+				{"All", models.PageFilter{Limit: 10}, []int{6, 5, 3, 2, 1}},
+				{"Before, skipping the expired", models.PageFilter{Limit: 2, Before: snippet(5)}, []int{3, 2}},
+				{"Before, last page", models.PageFilter{Limit: 2, Before: snippet(2)}, []int{1}},
+				{"Before the first", models.PageFilter{Limit: 2, Before: snippet(1)}, nil},
+				{"After, closest to the cursor", models.PageFilter{Limit: 2, After: snippet(1)}, []int{3, 2}},
+				{"After, skipping the expired", models.PageFilter{Limit: 2, After: snippet(3)}, []int{6, 5}},
+				{"After, first page", models.PageFilter{Limit: 2, After: snippet(5)}, []int{6}},
+				{"After the last", models.PageFilter{Limit: 2, After: snippet(6)}, nil},
+				{"Tags", models.PageFilter{Limit: 2, Tags: []string{"odd"}}, []int{5, 3}},
+				{"Tags before", models.PageFilter{Limit: 2, Tags: []string{"odd"}, Before: snippet(3)}, []int{1}},
+				{"Tags after", models.PageFilter{Limit: 2, Tags: []string{"odd"}, After: snippet(1)}, []int{5, 3}},
+				{"Unknown tag", models.PageFilter{Limit: 2, Tags: []string{"even"}}, nil},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					page, err := stores.snippets.Page(t.Context(), tt.filter)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					var got, want []int
+					for _, s := range page {
+						got = append(got, s.ID)
+					}
+					for _, n := range tt.want {
+						want = append(want, snippet(n))
+					}
+					if !slices.Equal(got, want) {
+						t.Errorf("got snippets %v; want %v", got, want)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestPurgeExpired(t *testing.T) {
+	for name, stores := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			err := stores.users.Insert(t.Context(), "Alice", "alice@example.com", "pa$$word")
+			if err != nil {
+				t.Fatal(err)
+			}
+			userID, err := stores.users.Authenticate(t.Context(), "alice@example.com", "pa$$word")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the order of the expiries isn't the one of the IDs
+			var ids []int
+			for _, expires := range []int{-1, -3, 7, -2} {
+				id, err := stores.snippets.Insert(t.Context(), &models.Snippet{Title: "Hello", Content: "hello", ContentType: models.ContentTypeText, UserID: userID}, expires)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids = append(ids, id)
+			}
+
+			// each batch deletes the snippets which expired first
+			for _, want := range [][]int{{ids[1]}, {ids[3]}, {ids[0]}, nil} {
+				n, err := stores.snippets.PurgeExpired(t.Context(), models.Now(), 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n != len(want) {
+					t.Errorf("got %d snippets purged; want %d", n, len(want))
+				}
+
+				var left []int
+				for _, id := range ids {
+					if _, err := stores.snippets.GetIncludingExpired(t.Context(), id); err == nil {
+						left = append(left, id)
+					}
+				}
+				for _, id := range want {
+					ids = slices.DeleteFunc(ids, func(i int) bool { return i == id })
+				}
+				if !slices.Equal(left, ids) {
+					t.Errorf("got snippets %v left; want %v", left, ids)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// setTags replaces the tags of a snippet, creating the tags which don't exist
+// yet. It's meant to run in the transaction that changes the snippet.
+func setTags(ctx context.Context, tx *sql.Tx, dialect *Dialect, snippetID int, tags []string) error {
+	_, err := tx.ExecContext(ctx, dialect.rebind(`DELETE FROM snippet_tags WHERE snippet_id = ?`), snippetID)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		// the unique index on tags.name makes this a no-op for existing tags
+		_, err = tx.ExecContext(ctx, dialect.rebind(dialect.insertIgnore(`INSERT INTO tags (name) VALUES (?)`)), tag)
+		if err != nil {
+			return err
+		}
+
+		stmt := `INSERT INTO snippet_tags (snippet_id, tag_id)
+		SELECT ?, id FROM tags WHERE name = ?`
+
+		_, err = tx.ExecContext(ctx, dialect.rebind(stmt), snippetID, tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// attachTags fills the Tags field of the given snippets with a single query
+func (m *SnippetModel) attachTags(ctx context.Context, snippets []*Snippet) error {
+	if len(snippets) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]*Snippet, len(snippets))
+	ids := make([]any, len(snippets))
+	for i, s := range snippets {
+		byID[s.ID] = s
+		ids[i] = s.ID
+	}
+
+	stmt := `SELECT st.snippet_id, t.name FROM snippet_tags st
+	INNER JOIN tags t ON t.id = st.tag_id
+	WHERE st.snippet_id IN (?` + strings.Repeat(", ?", len(ids)-1) + `)
+	ORDER BY t.name`
+
+	rows, err := m.DB.QueryContext(ctx, m.Dialect.rebind(stmt), ids...)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var name string
+		if err = rows.Scan(&id, &name); err != nil {
+			return err
+		}
+		byID[id].Tags = append(byID[id].Tags, name)
+	}
+
+	return rows.Err()
+}
+
+// taggedClause returns a condition on snippets.id selecting the snippets
+// having all the given tags, along with its arguments
+func taggedClause(tags []string) (string, []any) {
+	args := make([]any, 0, len(tags)+1)
+	for _, tag := range tags {
+		args = append(args, tag)
+	}
+	args = append(args, len(tags))
+
+	clause := `id IN (SELECT st.snippet_id FROM snippet_tags st
+	INNER JOIN tags t ON t.id = st.tag_id WHERE t.name IN (?` + strings.Repeat(", ?", len(tags)-1) + `)
+	GROUP BY st.snippet_id HAVING COUNT(*) = ?)`
+
+	return clause, args
+}
@@ -0,0 +1,189 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// scopes limit what an API token can be used for
+const (
+	ScopeRead   = "read"
+	ScopeWrite  = "write"
+	ScopeDelete = "delete"
+)
+
+// Scopes lists every token scope, in the order they're offered to users
+var Scopes = []string{ScopeRead, ScopeWrite, ScopeDelete}
+
+// tokenPrefix starts every API token, so that leaked tokens are easy to
+// recognize by secret scanners
+const tokenPrefix = "sbx_"
+
+// Token is a personal API token. Only a SHA-256 hash of the token is stored,
+// the token itself is shown once to the user when it's created. LastUsed is
+// the zero time if the token was never used.
+type Token struct {
+	ID       int
+	UserID   int
+	Name     string
+	Scopes   []string
+	Created  time.Time
+	LastUsed time.Time
+}
+
+// HasScope returns true if the token grants the given scope
+func (t *Token) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+// TokenModel wraps a sql.DB connection pool for managing API tokens, Dialect
+// is the SQL dialect of the database. Timeout bounds the queries of each
+// method, if not zero. TracerProvider creates the spans of the methods, the
+// global one if nil.
+type TokenModel struct {
+	DB             *sql.DB
+	Dialect        *Dialect
+	Timeout        time.Duration
+	TracerProvider trace.TracerProvider
+}
+
+// GenerateToken returns a new random API token
+func GenerateToken() string {
+	// 20 random bytes encode to 32 base32 characters without padding
+	b := make([]byte, 20)
+	rand.Read(b)
+	return tokenPrefix + strings.ToLower(base32.StdEncoding.EncodeToString(b))
+}
+
+// HashToken returns the SHA-256 hash of a token, which is what gets stored.
+// Tokens are long random strings, so a fast hash is enough.
+func HashToken(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
+
+// ValidTokenFormat returns false for strings which can't be API tokens, so
+// they can be rejected without a lookup
+func ValidTokenFormat(plaintext string) bool {
+	return strings.HasPrefix(plaintext, tokenPrefix)
+}
+
+// Insert creates a new token for a user, and returns the token itself
+// along with its database ID
+func (m *TokenModel) Insert(ctx context.Context, userID int, name string, scopes []string) (plaintext string, id int, err error) {
+	ctx, end := m.Dialect.startCall(ctx, m.TracerProvider, "TokenModel.Insert", "INSERT", m.Timeout)
+	defer func() { err = end(err) }()
+
+	plaintext = GenerateToken()
+
+	stmt := `INSERT INTO tokens (user_id, name, hash, scopes, created)
+	VALUES(?, ?, ?, ?, ?)`
+
+	id, err = m.Dialect.insert(ctx, m.DB, stmt, userID, name, HashToken(plaintext), strings.Join(scopes, ","), Now())
+	if err != nil {
+		return "", 0, err
+	}
+
+	return plaintext, id, nil
+}
+
+// ForUser returns the tokens of a user, newest first
+func (m *TokenModel) ForUser(ctx context.Context, userID int) (tokens []*Token, err error) {
+	ctx, end := m.Dialect.startCall(ctx, m.TracerProvider, "TokenModel.ForUser", "SELECT", m.Timeout)
+	defer func() { err = end(err) }()
+
+	stmt := `SELECT id, user_id, name, scopes, created, last_used FROM tokens
+	WHERE user_id = ? ORDER BY id DESC`
+
+	rows, err := m.DB.QueryContext(ctx, m.Dialect.rebind(stmt), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	tokens = []*Token{}
+
+	for rows.Next() {
+		t := &Token{}
+		var scopes string
+		var lastUsed sql.NullTime
+		err = rows.Scan(&t.ID, &t.UserID, &t.Name, &scopes, &t.Created, &lastUsed)
+		if err != nil {
+			return nil, err
+		}
+		t.Scopes = splitScopes(scopes)
+		t.LastUsed = lastUsed.Time
+		tokens = append(tokens, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Authenticate looks up the token matching plaintext and records that it was
+// used. It returns ErrInvalidCredentials if there's no such token.
+func (m *TokenModel) Authenticate(ctx context.Context, plaintext string) (t *Token, err error) {
+	ctx, end := m.Dialect.startCall(ctx, m.TracerProvider, "TokenModel.Authenticate", "SELECT", m.Timeout)
+	defer func() { err = end(err) }()
+
+	if !ValidTokenFormat(plaintext) {
+		return nil, ErrInvalidCredentials
+	}
+
+	hash := HashToken(plaintext)
+
+	stmt := `SELECT id, user_id, name, scopes, created FROM tokens WHERE hash = ?`
+
+	t = &Token{}
+	var scopes string
+	err = m.DB.QueryRowContext(ctx, m.Dialect.rebind(stmt), hash).Scan(&t.ID, &t.UserID, &t.Name, &scopes, &t.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	t.Scopes = splitScopes(scopes)
+
+	_, err = m.DB.ExecContext(ctx, m.Dialect.rebind(`UPDATE tokens SET last_used = ? WHERE id = ?`), Now(), t.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Revoke deletes a token of the given user. It returns ErrNoRecord if the
+// user has no such token.
+func (m *TokenModel) Revoke(ctx context.Context, userID, id int) (err error) {
+	ctx, end := m.Dialect.startCall(ctx, m.TracerProvider, "TokenModel.Revoke", "DELETE", m.Timeout)
+	defer func() { err = end(err) }()
+
+	result, err := m.DB.ExecContext(ctx, m.Dialect.rebind(`DELETE FROM tokens WHERE id = ? AND user_id = ?`), id, userID)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(result)
+}
+
+// splitScopes parses the comma separated list of scopes stored in the database
+func splitScopes(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
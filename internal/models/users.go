@@ -1,12 +1,12 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"errors"
-	"strings"
 	"time"
 
-	"github.com/go-sql-driver/mysql"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -18,33 +18,52 @@ type User struct {
 	Created        time.Time
 }
 
+// DefaultBcryptCost is the cost of the password hashes when none is set
+const DefaultBcryptCost = 12
+
+// UserModel wraps a sql.DB connection pool, Dialect is the SQL dialect of
+// the database. BcryptCost is the cost of the password hashes,
+// DefaultBcryptCost if zero. Timeout bounds the queries of each method, if
+// not zero. TracerProvider creates the spans of the methods, the global one
+// if nil.
 type UserModel struct {
-	DB *sql.DB
+	DB             *sql.DB
+	Dialect        *Dialect
+	BcryptCost     int
+	Timeout        time.Duration
+	TracerProvider trace.TracerProvider
+}
+
+// HashPassword returns the bcrypt hash of a password, with the given cost or
+// DefaultBcryptCost if zero
+func HashPassword(password string, cost int) ([]byte, error) {
+	if cost == 0 {
+		cost = DefaultBcryptCost
+	}
+	return bcrypt.GenerateFromPassword([]byte(password), cost)
 }
 
 // Insert adds a new record to the users table
-func (m *UserModel) Insert(name, email, password string) error {
+func (m *UserModel) Insert(ctx context.Context, name, email, password string) (err error) {
+	ctx, end := m.Dialect.startCall(ctx, m.TracerProvider, "UserModel.Insert", "INSERT", m.Timeout)
+	defer func() { err = end(err) }()
+
 	// create a bcrypt hash of the password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	hashedPassword, err := HashPassword(password, m.BcryptCost)
 	if err != nil {
 		return err
 	}
 
 	stmt := `INSERT INTO users (name, email, hashed_password, created)
-	VALUES(?, ?, ?, UTC_TIMESTAMP())`
+	VALUES(?, ?, ?, ?)`
 
 	// insert into users table
-	_, err = m.DB.Exec(stmt, name, email, string(hashedPassword))
+	_, err = m.DB.ExecContext(ctx, m.Dialect.rebind(stmt), name, email, string(hashedPassword), Now())
 	if err != nil {
-		// if error, check wether the error has type *mysql.MySQLError, if it does,
-		// assign it to mySQLError variable. Then check if it relates to our
-		// users_uc_email key by checking error code equals 1062 and contents
-		// of error message string. If it does, return ErrDuplicateEmail error
-		var mySQLError *mysql.MySQLError
-		if errors.As(err, &mySQLError) {
-			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "users_uc_email") {
-				return ErrDuplicateEmail
-			}
+		// if the error relates to our users_uc_email key, return
+		// ErrDuplicateEmail error
+		if m.Dialect.isUniqueViolation(err, "users_uc_email") {
+			return ErrDuplicateEmail
 		}
 		return err
 	}
@@ -53,15 +72,17 @@ func (m *UserModel) Insert(name, email, password string) error {
 
 // Authenticate verifies wether a user exists with provided email & password,
 // return user ID if they do
-func (m *UserModel) Authenticate(email, password string) (int, error) {
+func (m *UserModel) Authenticate(ctx context.Context, email, password string) (id int, err error) {
+	ctx, end := m.Dialect.startCall(ctx, m.TracerProvider, "UserModel.Authenticate", "SELECT", m.Timeout)
+	defer func() { err = end(err) }()
+
 	// retrieve the id & hashed pwd associated with given email, if
 	// no match exists return ErrInvalidCredentials error
-	var id int
 	var hashedPassword []byte
 
 	stmt := `SELECT id, hashed_password FROM users WHERE email = ?`
 
-	err := m.DB.QueryRow(stmt, email).Scan(&id, &hashedPassword)
+	err = m.DB.QueryRowContext(ctx, m.Dialect.rebind(stmt), email).Scan(&id, &hashedPassword)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return 0, ErrInvalidCredentials
@@ -85,11 +106,12 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 }
 
 // Exists checks if a user exists with given ID
-func (m *UserModel) Exists(id int) (bool, error) {
-	var exists bool
+func (m *UserModel) Exists(ctx context.Context, id int) (exists bool, err error) {
+	ctx, end := m.Dialect.startCall(ctx, m.TracerProvider, "UserModel.Exists", "SELECT", m.Timeout)
+	defer func() { err = end(err) }()
 
 	stmt := "SELECT EXISTS(SELECT true FROM users WHERE id = ?)"
 
-	err := m.DB.QueryRow(stmt, id).Scan(&exists)
+	err = m.DB.QueryRowContext(ctx, m.Dialect.rebind(stmt), id).Scan(&exists)
 	return exists, err
 }
@@ -0,0 +1,153 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// words in a title count this many times more than words in the content
+// when ranking results
+const titleWeight = 3
+
+// Hit is a document matching a query, with its relevance score
+type Hit struct {
+	ID    int
+	Score float64
+}
+
+// Index is an inverted index mapping each word to the documents containing it
+// and the number of times it appears in them. It's safe for concurrent use.
+type Index struct {
+	mu sync.RWMutex
+	// postings maps a word to the weighted term frequency of each document
+	postings map[string]map[int]int
+	// words keeps the distinct words of each document, to remove it later
+	words map[int][]string
+}
+
+// NewIndex returns an empty index
+func NewIndex() *Index {
+	return &Index{
+		postings: make(map[string]map[int]int),
+		words:    make(map[int][]string),
+	}
+}
+
+// Add indexes a document, replacing any previous version of it
+func (ix *Index) Add(id int, title, content string) {
+	freqs := make(map[string]int)
+	for _, w := range Tokenize(title) {
+		freqs[w] += titleWeight
+	}
+	for _, w := range Tokenize(content) {
+		freqs[w]++
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(id)
+
+	words := make([]string, 0, len(freqs))
+	for w, n := range freqs {
+		if ix.postings[w] == nil {
+			ix.postings[w] = make(map[int]int)
+		}
+		ix.postings[w][id] = n
+		words = append(words, w)
+	}
+	ix.words[id] = words
+}
+
+// Remove drops a document from the index
+func (ix *Index) Remove(id int) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(id)
+}
+
+func (ix *Index) remove(id int) {
+	for _, w := range ix.words[id] {
+		delete(ix.postings[w], id)
+		if len(ix.postings[w]) == 0 {
+			delete(ix.postings, w)
+		}
+	}
+	delete(ix.words, id)
+}
+
+// Len returns the number of documents in the index
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	return len(ix.words)
+}
+
+// Search returns the documents containing every word of the included phrases
+// and none of the excluded single words, best matches first. Scores are a sum
+// of tf-idf weights. As the index doesn't keep word positions, phrases and
+// multi-word exclusions must be checked against the documents with
+// Query.Match.
+func (ix *Index) Search(q Query) []Hit {
+	if q.Empty() {
+		return nil
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	var words []string
+	for _, p := range q.Include {
+		words = append(words, p...)
+	}
+
+	// start from the rarest word to keep the candidate set small
+	sort.Slice(words, func(i, j int) bool {
+		return len(ix.postings[words[i]]) < len(ix.postings[words[j]])
+	})
+
+	scores := make(map[int]float64)
+	for id := range ix.postings[words[0]] {
+		scores[id] = 0
+	}
+
+	n := float64(len(ix.words))
+	for _, w := range words {
+		docs := ix.postings[w]
+		idf := math.Log(1 + n/float64(len(docs)+1))
+		for id := range scores {
+			tf, ok := docs[id]
+			if !ok {
+				delete(scores, id)
+				continue
+			}
+			scores[id] += (1 + math.Log(float64(tf))) * idf
+		}
+	}
+
+	for _, p := range q.Exclude {
+		if len(p) != 1 {
+			continue
+		}
+		for id := range ix.postings[p[0]] {
+			delete(scores, id)
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{ID: id, Score: score})
+	}
+	// newest documents first when scores are equal
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID > hits[j].ID
+	})
+
+	return hits
+}
@@ -0,0 +1,229 @@
+// Package search implements a small in-memory inverted index over snippet
+// titles and contents, with a query syntax supporting quoted phrases and
+// -exclusion terms. It works with any storage backend as it doesn't rely on
+// database full-text features.
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Query is a parsed search query. Each phrase is a sequence of tokens, a
+// single word being a one token phrase. A matching document must contain all
+// the Include phrases and none of the Exclude ones.
+type Query struct {
+	Include [][]string
+	Exclude [][]string
+}
+
+// Parse parses a query string such as `deploy "docker compose" -staging`.
+// Terms are case-insensitive, a leading - excludes a term or a quoted phrase,
+// and an unterminated quote runs until the end of the query.
+func Parse(s string) Query {
+	var q Query
+
+	for s != "" {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+		if s == "" {
+			break
+		}
+
+		exclude := false
+		if s[0] == '-' {
+			exclude = true
+			s = s[1:]
+		}
+
+		var part string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				part, s = s[1:], ""
+			} else {
+				part, s = s[1:end+1], s[end+2:]
+			}
+		} else {
+			end := strings.IndexFunc(s, unicode.IsSpace)
+			if end < 0 {
+				part, s = s, ""
+			} else {
+				part, s = s[:end], s[end:]
+			}
+		}
+
+		phrase := Tokenize(part)
+		if len(phrase) == 0 {
+			continue
+		}
+		if exclude {
+			q.Exclude = append(q.Exclude, phrase)
+		} else {
+			q.Include = append(q.Include, phrase)
+		}
+	}
+
+	return q
+}
+
+// Empty returns true if the query has nothing to search for. A query made of
+// exclusions only is empty, as it would match almost everything.
+func (q Query) Empty() bool {
+	return len(q.Include) == 0
+}
+
+// Match reports whether text contains all the included phrases and none of
+// the excluded ones
+func (q Query) Match(text string) bool {
+	tokens := Tokenize(text)
+	for _, p := range q.Include {
+		if !containsPhrase(tokens, p) {
+			return false
+		}
+	}
+	for _, p := range q.Exclude {
+		if containsPhrase(tokens, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// Tokenize splits text into lowercased words made of letters, digits and
+// underscores
+func Tokenize(text string) []string {
+	var tokens []string
+	for _, t := range scan(text) {
+		tokens = append(tokens, t.text)
+	}
+	return tokens
+}
+
+// token is a word of a text along with its byte offsets
+type token struct {
+	text       string
+	start, end int
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+func scan(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, token{strings.ToLower(text[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{strings.ToLower(text[start:]), start, len(text)})
+	}
+	return tokens
+}
+
+func containsPhrase(tokens, phrase []string) bool {
+	return phraseAt(tokens, phrase, 0) >= 0
+}
+
+// phraseAt returns the index of the first occurrence of phrase in tokens at
+// or after from, or -1
+func phraseAt(tokens, phrase []string, from int) int {
+	for i := from; i+len(phrase) <= len(tokens); i++ {
+		match := true
+		for j := range phrase {
+			if tokens[i+j] != phrase[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
+
+// Span is the byte range of a match in a text
+type Span struct {
+	Start, End int
+}
+
+// Matches returns the byte ranges of text covered by occurrences of the
+// included phrases of the query, in order and without overlaps
+func (q Query) Matches(text string) []Span {
+	scanned := scan(text)
+	words := make([]string, len(scanned))
+	for i, t := range scanned {
+		words[i] = t.text
+	}
+
+	// a phrase occurrence spans from its first word to its last one,
+	// including whatever separates them
+	var spans []Span
+	for _, p := range q.Include {
+		for i := phraseAt(words, p, 0); i >= 0; i = phraseAt(words, p, i+1) {
+			spans = append(spans, Span{scanned[i].start, scanned[i+len(p)-1].end})
+		}
+	}
+
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].Start < spans[j].Start
+	})
+
+	// merge the overlapping spans
+	var merged []Span
+	for _, span := range spans {
+		if n := len(merged); n > 0 && span.Start <= merged[n-1].End {
+			merged[n-1].End = max(merged[n-1].End, span.End)
+			continue
+		}
+		merged = append(merged, span)
+	}
+	return merged
+}
+
+// Excerpt returns a part of text of about width characters around the first
+// match of the query, with ellipses where it has been cut. Line breaks are
+// turned into spaces.
+func (q Query) Excerpt(text string, width int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= width {
+		return text
+	}
+
+	start := 0
+	if spans := q.Matches(text); len(spans) > 0 {
+		// start a little before the match, at a rune boundary
+		start = spans[0].Start
+		for n := 0; start > 0 && n < width/4; n++ {
+			_, size := utf8.DecodeLastRuneInString(text[:start])
+			start -= size
+		}
+	}
+
+	end := start
+	for n := 0; end < len(text) && n < width; n++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+
+	excerpt := text[start:end]
+	if start > 0 {
+		excerpt = "…" + excerpt
+	}
+	if end < len(text) {
+		excerpt += "…"
+	}
+	return excerpt
+}
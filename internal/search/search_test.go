@@ -0,0 +1,92 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  Query
+	}{
+		{
+			name:  "Terms",
+			query: "Docker  compose",
+			want:  Query{Include: [][]string{{"docker"}, {"compose"}}},
+		},
+		{
+			name:  "Phrase and exclusion",
+			query: `"docker compose" -staging -"dry run"`,
+			want: Query{
+				Include: [][]string{{"docker", "compose"}},
+				Exclude: [][]string{{"staging"}, {"dry", "run"}},
+			},
+		},
+		{
+			name:  "Unterminated quote",
+			query: `sql "left join`,
+			want:  Query{Include: [][]string{{"sql"}, {"left", "join"}}},
+		},
+		{
+			name:  "Punctuation only",
+			query: `- "" !!`,
+			want:  Query{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Parse(tt.query)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexSearch(t *testing.T) {
+	ix := NewIndex()
+	ix.Add(1, "Backup script", "pg_dump the database then rsync it")
+	ix.Add(2, "Restore", "restore the database from a backup")
+	ix.Add(3, "Deploy", "run the staging deploy")
+
+	hits := ix.Search(Parse("backup database"))
+	if len(hits) != 2 || hits[0].ID != 1 || hits[1].ID != 2 {
+		t.Errorf("got %v; want documents 1 then 2", hits)
+	}
+
+	if hits := ix.Search(Parse("database -rsync")); len(hits) != 1 || hits[0].ID != 2 {
+		t.Errorf("got %v; want document 2", hits)
+	}
+
+	ix.Remove(2)
+	if hits := ix.Search(Parse("restore")); len(hits) != 0 {
+		t.Errorf("got %v; want no documents", hits)
+	}
+
+	// re-adding a document replaces its previous version
+	ix.Add(3, "Deploy", "run the production deploy")
+	if hits := ix.Search(Parse("staging")); len(hits) != 0 {
+		t.Errorf("got %v; want no documents", hits)
+	}
+}
+
+func TestQueryMatches(t *testing.T) {
+	q := Parse(`"left join" users`)
+	text := "SELECT * FROM Users LEFT  JOIN posts"
+
+	want := []Span{{14, 19}, {20, 30}}
+	got := q.Matches(text)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+
+	if !q.Match(text) {
+		t.Errorf("got no match; want match")
+	}
+	if Parse(`"join left"`).Match(text) {
+		t.Errorf("got match; want no match")
+	}
+}
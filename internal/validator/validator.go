@@ -2,6 +2,7 @@ package validator
 
 import (
 	"regexp"
+	"slices"
 	"strings"
 	"unicode/utf8"
 )
@@ -55,14 +56,9 @@ func MaxChars(value string, n int) bool {
 	return utf8.RuneCountInString(value) <= n
 }
 
-// PermittedInt() returns true if a value is in a list of permitted characters.
-func PermittedInt(value int, permittedValues ...int) bool {
-	for i := range permittedValues {
-		if value == permittedValues[i] {
-			return true
-		}
-	}
-	return false
+// PermittedValue() returns true if a value is in a list of permitted values.
+func PermittedValue[T comparable](value T, permittedValues ...T) bool {
+	return slices.Contains(permittedValues, value)
 }
 
 // Minchars() returns true if a value contains at least n chars
@@ -73,3 +69,45 @@ func MinChars(value string, n int) bool {
 func Matches(value string, rx *regexp.Regexp) bool {
 	return rx.MatchString(value)
 }
+
+// TagRX matches a tag name: lowercase letters, digits and a few separators,
+// starting with a letter or a digit.
+var TagRX = regexp.MustCompile(`^[a-z0-9][a-z0-9_.+-]*$`)
+
+// MaxItems() returns true if a list contains no more than n values.
+func MaxItems(values []string, n int) bool {
+	return len(values) <= n
+}
+
+// AllMaxChars() returns true if every value of a list contains no more
+// than n characters.
+func AllMaxChars(values []string, n int) bool {
+	for _, value := range values {
+		if !MaxChars(value, n) {
+			return false
+		}
+	}
+	return true
+}
+
+// AllMatches() returns true if every value of a list matches a regular
+// expression.
+func AllMatches(values []string, rx *regexp.Regexp) bool {
+	for _, value := range values {
+		if !Matches(value, rx) {
+			return false
+		}
+	}
+	return true
+}
+
+// AllPermitted() returns true if every value of a list is in a list of
+// permitted values.
+func AllPermitted[T comparable](values []T, permittedValues ...T) bool {
+	for _, value := range values {
+		if !PermittedValue(value, permittedValues...) {
+			return false
+		}
+	}
+	return true
+}
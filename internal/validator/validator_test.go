@@ -0,0 +1,98 @@
+package validator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTagRX(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  string
+		want bool
+	}{
+		{"Letters", "sql", true},
+		{"Digits", "2024", true},
+		{"Separators", "c++_v1.2-rc", true},
+		{"Empty", "", false},
+		{"Uppercase", "SQL", false},
+		{"Leading separator", "-sql", false},
+		{"Space", "shell script", false},
+		{"Slash", "ci/cd", false},
+		{"Non-ASCII letter", "café", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Matches(tt.tag, TagRX); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxItems(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		n      int
+		want   bool
+	}{
+		{"None", nil, 2, true},
+		{"Under", []string{"a"}, 2, true},
+		{"At the limit", []string{"a", "b"}, 2, true},
+		{"Over", []string{"a", "b", "c"}, 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MaxItems(tt.values, tt.n); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllMaxChars(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		n      int
+		want   bool
+	}{
+		{"None", nil, 3, true},
+		{"All short", []string{"go", "sql"}, 3, true},
+		{"One too long", []string{"go", "bash"}, 3, false},
+		// characters are counted, not bytes
+		{"Multibyte characters", []string{"été"}, 3, true},
+		{"Long tag", []string{strings.Repeat("a", 31)}, 30, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AllMaxChars(tt.values, tt.n); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   bool
+	}{
+		{"None", nil, true},
+		{"All valid", []string{"sql", "runbook"}, true},
+		{"One invalid", []string{"sql", "Bad/Tag"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AllMatches(tt.values, TagRX); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}